@@ -64,3 +64,14 @@ Return the appropriate apiVersion for RBAC resources.
 {{- print "rbac.authorization.k8s.io/v1beta1" }}
 {{- end }}
 {{- end -}}
+
+{{/*
+Return the DNS provider, embedded when the embedded DNS server is enabled.
+*/}}
+{{- define "kic.dnsProvider" -}}
+{{- if .Values.controllerManager.embeddedDNS.enabled }}
+{{- print "embedded" }}
+{{- else }}
+{{- .Values.controllerManager.dnsProvider | default "coredns" }}
+{{- end }}
+{{- end -}}
@@ -22,6 +22,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
@@ -30,14 +31,17 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
 	ctrl "sigs.k8s.io/controller-runtime"
-	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/certwatcher"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	"sigs.k8s.io/controller-runtime/pkg/metrics/filters"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
 
 	"github.com/pelotech/kic/internal/controller"
 	// +kubebuilder:scaffold:imports
@@ -50,6 +54,8 @@ var (
 
 func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(gatewayv1.AddToScheme(scheme))
+	utilruntime.Must(gatewayv1alpha2.AddToScheme(scheme))
 
 	// +kubebuilder:scaffold:scheme
 }
@@ -68,7 +74,27 @@ func main() {
 	var watchedNamespaces string
 	var ingressAnnotation string
 	var ingressControllerService string
+	var ingressClassServices string
+	var ingressTargetSource string
 	var coreDNSExcludedNamespaces string
+	var clusterDomain string
+	var protectedDomains string
+	var enableGatewayAPI bool
+	var coreDNSServerBlocks string
+	var managedConfigMap string
+	var coreDNSImportPath string
+	var coreDNSBackend string
+	var coreDNSZone string
+	var dnsProvider string
+	var nodeLocalDNS bool
+	var debounce time.Duration
+	var serverSideApply bool
+	var kubeDNSRollout bool
+	var embeddedDNSAddress string
+	var embeddedDNSUpstream string
+	var rfc2136Server string
+	var rfc2136Zone string
+	var rfc2136TSIGSecret string
 
 	flag.StringVar(&metricsAddr, "metrics-bind-address", "0", "The address the metrics endpoint binds to. "+
 		"Use :8443 for HTTPS or :8080 for HTTP, or leave as 0 to disable the metrics service.")
@@ -95,8 +121,62 @@ func main() {
 	flag.StringVar(&ingressControllerService, "ingress-controller-service",
 		"ingress-nginx-controller.ingress-nginx.svc.cluster.local",
 		"The fully qualified domain name of the ingress controller service.")
+	flag.StringVar(&ingressClassServices, "ingress-class-services", "",
+		"A comma-separated list of class=fqdn pairs mapping an ingress class to its controller service. "+
+			"Ingresses of other classes use --ingress-controller-service.")
+	flag.StringVar(&ingressTargetSource, "ingress-target-source", controller.TargetSourceConfig,
+		"Where Ingress targets come from: config uses --ingress-class-services and --ingress-controller-service, "+
+			"status the status.loadBalancer addresses of the Ingress, service the Service holding those addresses. "+
+			"Ingresses without an address fall back to config.")
 	flag.StringVar(&coreDNSExcludedNamespaces, "coredns-excluded-namespaces", "",
 		"A comma-separated list of namespaces to exclude from CoreDNS rewrite rules.")
+	flag.StringVar(&clusterDomain, "cluster-domain", "cluster.local",
+		"The DNS domain of the cluster, used to build service FQDNs.")
+	flag.StringVar(&protectedDomains, "protected-domains", "",
+		"A comma-separated list of domains that are never rewritten, nor any name below them. "+
+			"Defaults to the cluster domain, in-addr.arpa and ip6.arpa.")
+	flag.BoolVar(&enableGatewayAPI, "enable-gateway-api", false,
+		"If set, Gateway API HTTPRoutes, GRPCRoutes and TLSRoutes are watched and their hostnames rewritten "+
+			"to the parent Gateway's service.")
+	flag.StringVar(&coreDNSServerBlocks, "coredns-server-blocks", "",
+		"A comma-separated list of CoreDNS server blocks, as zone:port keys such as .:53, that receive the "+
+			"managed rules. If empty, the server block with the kubernetes plugin is used.")
+	flag.StringVar(&managedConfigMap, "coredns-managed-configmap", "",
+		"The name of a ConfigMap in kube-system owned by kic that holds the managed rules. If set, the CoreDNS "+
+			"Corefile only gets an import line for --coredns-import-path instead of the rules themselves.")
+	flag.StringVar(&coreDNSImportPath, "coredns-import-path", controller.DefaultCoreDNSImportPath,
+		"The path CoreDNS imports the managed ConfigMap's files from. Only used with --coredns-managed-configmap.")
+	flag.StringVar(&coreDNSBackend, "coredns-backend", controller.BackendRewrite,
+		"How Ingress hosts are resolved: rewrite writes rewrite rules to the target service name, hosts writes a "+
+			"hosts plugin block with the target service's ClusterIPs, file serves --coredns-zone from a zone file.")
+	flag.StringVar(&dnsProvider, "dns-provider", controller.ProviderCoreDNS,
+		"The DNS server Ingress hosts are written to, one of "+strings.Join(controller.DNSProviders(), ", ")+".")
+	flag.BoolVar(&kubeDNSRollout, "kube-dns-rollout", false,
+		"If set, the kube-dns provider rolls out the kube-dns Deployment whenever the dnsmasq configuration changes, "+
+			"since dnsmasq only reads it on start.")
+	flag.StringVar(&embeddedDNSAddress, "embedded-dns-address", controller.DefaultEmbeddedDNSAddress,
+		"The address the DNS server of the embedded provider listens on, over UDP and TCP.")
+	flag.StringVar(&embeddedDNSUpstream, "embedded-dns-upstream", "",
+		"The address of a DNS server answering the names the embedded provider has no record for. "+
+			"If empty, they are answered with NXDOMAIN.")
+	flag.StringVar(&rfc2136Server, "rfc2136-server", "",
+		"The address, as host:port, of the DNS server the rfc2136 provider sends dynamic updates to.")
+	flag.StringVar(&rfc2136Zone, "rfc2136-zone", "", "The zone the rfc2136 provider updates.")
+	flag.StringVar(&rfc2136TSIGSecret, "rfc2136-tsig-secret", "",
+		"The Secret, as namespace/name, holding the TSIG key of the rfc2136 provider in its name, algorithm and "+
+			"secret keys. If empty, updates are not signed.")
+	flag.BoolVar(&nodeLocalDNS, "node-local-dns", false,
+		"If set, and NodeLocal DNSCache is deployed, its Corefile is made to forward the zones of Ingress hosts to "+
+			"cluster DNS instead of upstream. The node-local-dns ConfigMap belongs to NodeLocal DNSCache, so this is "+
+			"opt-in.")
+	flag.DurationVar(&debounce, "debounce", controller.DefaultDebounce,
+		"How long changes are collected before the DNS records are rebuilt, so that a burst of them, such as a "+
+			"rollout touching many Ingresses, causes a single write.")
+	flag.BoolVar(&serverSideApply, "server-side-apply", false,
+		"If set, ConfigMaps are written with server-side apply and the kic field manager, which only owns the keys "+
+			"kic writes, instead of being updated whole.")
+	flag.StringVar(&coreDNSZone, "coredns-zone", "",
+		"The zone served authoritatively from a zone file, such as example.com. Required by the file backend.")
 
 	opts := zap.Options{
 		Development: true,
@@ -106,12 +186,10 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
-	var cacheOpts cache.Options
+	var watchedNS []string
 	if watchedNamespaces != "" {
-		ns := strings.Split(watchedNamespaces, ",")
-		cacheOpts.DefaultNamespaces = make(map[string]cache.Config, len(ns))
-		for _, n := range ns {
-			cacheOpts.DefaultNamespaces[strings.TrimSpace(n)] = cache.Config{}
+		for _, n := range strings.Split(watchedNamespaces, ",") {
+			watchedNS = append(watchedNS, strings.TrimSpace(n))
 		}
 	}
 
@@ -204,8 +282,24 @@ func main() {
 		})
 	}
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+	restConfig := ctrl.GetConfigOrDie()
+
+	// The route kinds are discovered before the manager is created, since its
+	// cache can only be told about Gateways when their CRDs are installed.
+	var gatewayRouteKinds []string
+	if enableGatewayAPI {
+		var err error
+		gatewayRouteKinds, err = discoverGatewayRouteKinds(restConfig)
+		if err != nil {
+			setupLog.Error(err, "unable to discover Gateway API route kinds")
+			os.Exit(1)
+		}
+		setupLog.Info("Gateway API support enabled", "routeKinds", gatewayRouteKinds)
+	}
+
+	mgr, err := ctrl.NewManager(restConfig, ctrl.Options{
 		Scheme:                 scheme,
+		Cache:                  controller.CacheOptions(watchedNS, gatewayRouteKinds),
 		Metrics:                metricsServerOptions,
 		WebhookServer:          webhookServer,
 		HealthProbeBindAddress: probeAddr,
@@ -236,17 +330,97 @@ func main() {
 		}
 	}
 
-	if err = (&controller.IngressReconciler{
+	protected := []string{clusterDomain, "in-addr.arpa", "ip6.arpa"}
+	if protectedDomains != "" {
+		protected = strings.Split(protectedDomains, ",")
+		for i := range protected {
+			protected[i] = strings.TrimSpace(protected[i])
+		}
+	}
+
+	switch coreDNSBackend {
+	case controller.BackendRewrite, controller.BackendHosts:
+	case controller.BackendFile:
+		if coreDNSZone == "" {
+			setupLog.Error(nil, "--coredns-zone is required by the file backend")
+			os.Exit(1)
+		}
+	default:
+		setupLog.Error(nil, "invalid --coredns-backend, expected rewrite, hosts or file", "backend", coreDNSBackend)
+		os.Exit(1)
+	}
+
+	switch ingressTargetSource {
+	case controller.TargetSourceConfig, controller.TargetSourceStatus, controller.TargetSourceService:
+	default:
+		setupLog.Error(nil, "invalid --ingress-target-source, expected config, status or service",
+			"source", ingressTargetSource)
+		os.Exit(1)
+	}
+
+	var serverBlocks []string
+	if coreDNSServerBlocks != "" {
+		serverBlocks = strings.Split(coreDNSServerBlocks, ",")
+		for i := range serverBlocks {
+			serverBlocks[i] = strings.TrimSpace(serverBlocks[i])
+		}
+	}
+
+	classServices := map[string]string{}
+	if ingressClassServices != "" {
+		for _, pair := range strings.Split(ingressClassServices, ",") {
+			class, service, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if !ok || class == "" || service == "" {
+				setupLog.Error(nil, "invalid --ingress-class-services entry, expected class=fqdn", "entry", pair)
+				os.Exit(1)
+			}
+			classServices[class] = service
+		}
+	}
+
+	ingressReconciler := &controller.IngressReconciler{
 		Client:                       mgr.GetClient(),
 		Scheme:                       mgr.GetScheme(),
+		Recorder:                     mgr.GetEventRecorderFor("kic"),
 		Log:                          ctrl.Log.WithName("controllers").WithName("Ingress"),
 		IngressAnnotation:            ingressAnnotation,
 		IngressControllerServiceName: ingressControllerService,
+		IngressClassServiceNames:     classServices,
+		TargetSource:                 ingressTargetSource,
 		CoreDNSExcludedNamespaces:    excludedNS,
-	}).SetupWithManager(mgr); err != nil {
+		ClusterDomain:                clusterDomain,
+		ProtectedDomains:             protected,
+		CoreDNSServerBlocks:          serverBlocks,
+		ManagedConfigMapName:         managedConfigMap,
+		CoreDNSImportPath:            coreDNSImportPath,
+		Backend:                      coreDNSBackend,
+		Zone:                         coreDNSZone,
+		DNSProvider:                  dnsProvider,
+		NodeLocalDNS:                 nodeLocalDNS,
+		Debounce:                     debounce,
+		ServerSideApply:              serverSideApply,
+		KubeDNSRollout:               kubeDNSRollout,
+		EmbeddedDNSAddress:           embeddedDNSAddress,
+		EmbeddedDNSUpstream:          embeddedDNSUpstream,
+		RFC2136Server:                rfc2136Server,
+		RFC2136Zone:                  rfc2136Zone,
+		RFC2136TSIGSecret:            rfc2136TSIGSecret,
+		APIReader:                    mgr.GetAPIReader(),
+	}
+	ingressReconciler.GatewayRouteKinds = gatewayRouteKinds
+	if err = ingressReconciler.SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Ingress")
 		os.Exit(1)
 	}
+	if len(gatewayRouteKinds) > 0 {
+		if err = (&controller.GatewayRouteReconciler{
+			Log:     ctrl.Log.WithName("controllers").WithName("GatewayRoute"),
+			Ingress: ingressReconciler,
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "GatewayRoute")
+			os.Exit(1)
+		}
+	}
 	// +kubebuilder:scaffold:builder
 
 	if metricsCertWatcher != nil {
@@ -280,3 +454,16 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// discoverGatewayRouteKinds returns the Gateway API route kinds the cluster serves.
+func discoverGatewayRouteKinds(config *rest.Config) ([]string, error) {
+	httpClient, err := rest.HTTPClientFor(config)
+	if err != nil {
+		return nil, err
+	}
+	mapper, err := apiutil.NewDynamicRESTMapper(config, httpClient)
+	if err != nil {
+		return nil, err
+	}
+	return controller.InstalledGatewayRouteKinds(mapper)
+}
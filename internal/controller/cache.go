@@ -0,0 +1,52 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+// CacheOptions returns the options of the manager's cache. Sources are only
+// cached in the watched namespaces, all of them when empty. The DNS
+// ConfigMaps are only cached in kube-system, and the Services and Gateways
+// that targets point to are cached in every namespace, since they usually
+// live outside the watched ones. Gateways are only cached when route kinds
+// were found by InstalledGatewayRouteKinds, as the cache cannot be created
+// for a kind the cluster does not serve.
+func CacheOptions(watchedNamespaces, gatewayRouteKinds []string) cache.Options {
+	allNamespaces := map[string]cache.Config{cache.AllNamespaces: {}}
+	opts := cache.Options{
+		ByObject: map[client.Object]cache.ByObject{
+			&corev1.ConfigMap{}: {Namespaces: map[string]cache.Config{metav1.NamespaceSystem: {}}},
+			&corev1.Service{}:   {Namespaces: allNamespaces},
+		},
+	}
+	if len(gatewayRouteKinds) > 0 {
+		opts.ByObject[&gatewayv1.Gateway{}] = cache.ByObject{Namespaces: allNamespaces}
+	}
+	if len(watchedNamespaces) > 0 {
+		opts.DefaultNamespaces = make(map[string]cache.Config, len(watchedNamespaces))
+		for _, namespace := range watchedNamespaces {
+			opts.DefaultNamespaces[namespace] = cache.Config{}
+		}
+	}
+	return opts
+}
@@ -0,0 +1,82 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+// newUnstartedCache creates a cache with the given options for a cluster
+// serving the given kinds. The cache is never started: reads it serves fail
+// with ErrCacheNotStarted, reads outside its namespaces are rejected before
+// reaching an informer.
+func newUnstartedCache(t *testing.T, opts cache.Options, objs ...client.Object) (cache.Cache, error) {
+	t.Helper()
+	scheme := newFakeClientBuilder(t).Build().Scheme()
+	mapper := meta.NewDefaultRESTMapper(nil)
+	for _, obj := range objs {
+		gvk, err := apiutil.GVKForObject(obj, scheme)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mapper.Add(gvk, meta.RESTScopeNamespace)
+	}
+	opts.Scheme, opts.Mapper = scheme, mapper
+	return cache.New(&rest.Config{Host: "http://127.0.0.1:0"}, opts)
+}
+
+func TestCacheOptions(t *testing.T) {
+	c, err := newUnstartedCache(t, CacheOptions([]string{"apps"}, []string{HTTPRouteKind}),
+		&corev1.ConfigMap{}, &corev1.Service{}, &networkingv1.Ingress{}, &gatewayv1.Gateway{})
+	if err != nil {
+		t.Fatalf("cache.New() returned error: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		key    client.ObjectKey
+		obj    client.Object
+		cached bool
+	}{
+		{"ConfigMap in kube-system", client.ObjectKey{Namespace: "kube-system", Name: "coredns"}, &corev1.ConfigMap{}, true},
+		{"ConfigMap in a watched namespace", client.ObjectKey{Namespace: "apps", Name: "coredns"}, &corev1.ConfigMap{}, false},
+		{"ConfigMap elsewhere", client.ObjectKey{Namespace: "default", Name: "coredns"}, &corev1.ConfigMap{}, false},
+		{"Ingress in a watched namespace", client.ObjectKey{Namespace: "apps", Name: "web"}, &networkingv1.Ingress{}, true},
+		{"Ingress elsewhere", client.ObjectKey{Namespace: "default", Name: "web"}, &networkingv1.Ingress{}, false},
+		{"Service elsewhere", client.ObjectKey{Namespace: "ingress-nginx", Name: "controller"}, &corev1.Service{}, true},
+		{"Gateway elsewhere", client.ObjectKey{Namespace: "gateways", Name: "public"}, &gatewayv1.Gateway{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := c.Get(context.Background(), tt.key, tt.obj)
+			var notStarted *cache.ErrCacheNotStarted
+			if cached := errors.As(err, &notStarted); cached != tt.cached {
+				t.Errorf("Get(%s) returned %v, expected the cache to serve it: %v", tt.key, err, tt.cached)
+			}
+		})
+	}
+}
+
+func TestCacheOptionsWithoutGatewayAPI(t *testing.T) {
+	// The Gateway API CRDs are not installed, so no route kind was found.
+	c, err := newUnstartedCache(t, CacheOptions(nil, nil),
+		&corev1.ConfigMap{}, &corev1.Service{}, &networkingv1.Ingress{})
+	if err != nil {
+		t.Fatalf("cache.New() returned error: %v", err)
+	}
+
+	err = c.Get(context.Background(), client.ObjectKey{Namespace: "apps", Name: "web"}, &networkingv1.Ingress{})
+	var notStarted *cache.ErrCacheNotStarted
+	if !errors.As(err, &notStarted) {
+		t.Errorf("Get() returned %v, expected the cache to serve Ingresses", err)
+	}
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"slices"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// providerConfigMaps returns the ConfigMaps the DNS provider writes the
+// records into, and the node-local-dns one when its zones are forwarded,
+// which are watched to repair any drift right away.
+func (r *IngressReconciler) providerConfigMaps() []client.ObjectKey {
+	var keys []client.ObjectKey
+	switch r.providerName() {
+	case ProviderCoreDNS:
+		keys = []client.ObjectKey{{Namespace: coreDNSConfigMapNamespace, Name: coreDNSConfigMapName}}
+		if r.ManagedConfigMapName != "" {
+			keys = append(keys, client.ObjectKey{Namespace: coreDNSConfigMapNamespace, Name: r.ManagedConfigMapName})
+		}
+	case ProviderKubeDNS:
+		keys = []client.ObjectKey{{Namespace: coreDNSConfigMapNamespace, Name: kubeDNSConfigMapName}}
+	}
+	if r.forwardsNodeLocalDNS() {
+		keys = append(keys, client.ObjectKey{Namespace: coreDNSConfigMapNamespace, Name: nodeLocalDNSConfigMapName})
+	}
+	return keys
+}
+
+// isProviderConfigMap lets events through only for the providerConfigMaps.
+func (r *IngressReconciler) isProviderConfigMap() predicate.Predicate {
+	keys := r.providerConfigMaps()
+	return predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		return slices.Contains(keys, client.ObjectKeyFromObject(obj))
+	})
+}
+
+// recordDrift counts the drift found while applying records as a repair when
+// the provider rendered them as it did last time: the DNS configuration was
+// then changed by someone else, rather than lagging behind a change of the
+// sources or of the Services the records resolve to.
+func (r *IngressReconciler) recordDrift(applied Applied) {
+	if r.lastRendered != nil && *r.lastRendered == applied.Rendered && !applied.Drift.Empty() {
+		r.Log.Info("DNS configuration was changed outside of kic, repaired it",
+			"provider", r.providerName(), "missing", applied.Drift.Missing, "stale", applied.Drift.Stale)
+		driftRepairs.WithLabelValues(r.providerName()).Inc()
+	}
+	r.lastRendered = &applied.Rendered
+}
@@ -0,0 +1,149 @@
+package controller
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+func TestIsProviderConfigMap(t *testing.T) {
+	configMap := func(namespace, name string) *corev1.ConfigMap {
+		return &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}}
+	}
+	tests := []struct {
+		name       string
+		reconciler *IngressReconciler
+		configMap  *corev1.ConfigMap
+		expected   bool
+	}{
+		{"coredns", &IngressReconciler{}, configMap("kube-system", "coredns"), true},
+		{"other namespace", &IngressReconciler{}, configMap("default", "coredns"), false},
+		{"other ConfigMap", &IngressReconciler{}, configMap("kube-system", "kube-proxy"), false},
+		{"managed", &IngressReconciler{ManagedConfigMapName: "kic-rules"}, configMap("kube-system", "kic-rules"), true},
+		{"kube-dns", &IngressReconciler{DNSProvider: ProviderKubeDNS}, configMap("kube-system", "kube-dns"), true},
+		{"kube-dns provider ignores coredns", &IngressReconciler{DNSProvider: ProviderKubeDNS}, configMap("kube-system", "coredns"), false},
+		{"rfc2136", &IngressReconciler{DNSProvider: ProviderRFC2136}, configMap("kube-system", "coredns"), false},
+		{"node-local-dns", &IngressReconciler{NodeLocalDNS: true}, configMap("kube-system", "node-local-dns"), true},
+		{"node-local-dns not forwarded", &IngressReconciler{}, configMap("kube-system", "node-local-dns"), false},
+		{"node-local-dns with rfc2136", &IngressReconciler{DNSProvider: ProviderRFC2136, NodeLocalDNS: true}, configMap("kube-system", "node-local-dns"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.reconciler.isProviderConfigMap().Update(event.UpdateEvent{ObjectOld: tt.configMap, ObjectNew: tt.configMap}); got != tt.expected {
+				t.Errorf("isProviderConfigMap() = %v, expected %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestUpdateDNSRepairsDrift(t *testing.T) {
+	const corefile = ".:53 {\n    kubernetes cluster.local\n}\n"
+	web := newIngress("apps", "web", "www.example.com")
+	coreDNS := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: coreDNSConfigMapName, Namespace: coreDNSConfigMapNamespace},
+		Data:       map[string]string{corefileKey: corefile},
+	}
+	c := newFakeClient(t, &web, coreDNS)
+	r := &IngressReconciler{Client: c, Log: logr.Discard(), IngressControllerServiceName: "controller.nginx.svc.cluster.local"}
+	repairs := driftRepairs.WithLabelValues(ProviderCoreDNS)
+	before := testutil.ToFloat64(repairs)
+
+	updateDNS := func() string {
+		t.Helper()
+		if err := r.updateDNS(context.Background()); err != nil {
+			t.Fatalf("updateDNS() returned error: %v", err)
+		}
+		var updated corev1.ConfigMap
+		if err := c.Get(context.Background(), client.ObjectKeyFromObject(coreDNS), &updated); err != nil {
+			t.Fatal(err)
+		}
+		return updated.Data[corefileKey]
+	}
+
+	// Injecting the rules for the first time is not a repair
+	injected := updateDNS()
+	if got := testutil.ToFloat64(repairs) - before; got != 0 {
+		t.Errorf("expected no repair after the first update, got %v", got)
+	}
+
+	// Someone drops the managed block
+	var edited corev1.ConfigMap
+	if err := c.Get(context.Background(), client.ObjectKeyFromObject(coreDNS), &edited); err != nil {
+		t.Fatal(err)
+	}
+	edited.Data[corefileKey] = corefile
+	if err := c.Update(context.Background(), &edited); err != nil {
+		t.Fatal(err)
+	}
+	if repaired := updateDNS(); repaired != injected {
+		t.Errorf("expected the managed block to be restored:\nExpected:\n%s\nActual:\n%s", injected, repaired)
+	}
+	if got := testutil.ToFloat64(repairs) - before; got != 1 {
+		t.Errorf("expected 1 repair after the managed block was dropped, got %v", got)
+	}
+
+	// A new Ingress changes the rules, which is not a repair
+	api := newIngress("apps", "api", "api.example.com")
+	if err := c.Create(context.Background(), &api); err != nil {
+		t.Fatal(err)
+	}
+	if updated := updateDNS(); !strings.Contains(updated, "api.example.com") {
+		t.Errorf("expected the new host in the Corefile:\n%s", updated)
+	}
+	if got := testutil.ToFloat64(repairs) - before; got != 1 {
+		t.Errorf("expected still 1 repair after a new Ingress, got %v", got)
+	}
+}
+
+func TestUpdateDNSServiceChangeIsNotDrift(t *testing.T) {
+	web := newIngress("apps", "web", "www.example.com")
+	coreDNS := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: coreDNSConfigMapName, Namespace: coreDNSConfigMapNamespace},
+		Data:       map[string]string{corefileKey: ".:53 {\n    kubernetes cluster.local\n}\n"},
+	}
+	nginx := newService("ingress", "nginx", "10.96.0.10")
+	c := newFakeClient(t, &web, coreDNS, nginx)
+	r := &IngressReconciler{
+		Client:                       c,
+		Log:                          logr.Discard(),
+		ClusterDomain:                "cluster.local",
+		Backend:                      BackendHosts,
+		IngressControllerServiceName: "nginx.ingress.svc.cluster.local",
+	}
+	repairs := driftRepairs.WithLabelValues(ProviderCoreDNS)
+	before := testutil.ToFloat64(repairs)
+
+	if err := r.updateDNS(context.Background()); err != nil {
+		t.Fatalf("updateDNS() returned error: %v", err)
+	}
+
+	// The Service is recreated with another ClusterIP, which the hosts entries follow
+	if err := c.Get(context.Background(), client.ObjectKeyFromObject(nginx), nginx); err != nil {
+		t.Fatal(err)
+	}
+	nginx.Spec.ClusterIP, nginx.Spec.ClusterIPs = "10.96.0.20", []string{"10.96.0.20"}
+	if err := c.Update(context.Background(), nginx); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.updateDNS(context.Background()); err != nil {
+		t.Fatalf("updateDNS() returned error: %v", err)
+	}
+
+	var updated corev1.ConfigMap
+	if err := c.Get(context.Background(), client.ObjectKeyFromObject(coreDNS), &updated); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(updated.Data[corefileKey], "10.96.0.20 www.example.com") {
+		t.Errorf("expected the new ClusterIP in the Corefile:\n%s", updated.Data[corefileKey])
+	}
+	if got := testutil.ToFloat64(repairs) - before; got != 0 {
+		t.Errorf("expected no repair after a ClusterIP change, got %v", got)
+	}
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// fieldOwner is the field manager of kic's writes, as shown in managedFields.
+	fieldOwner = "kic"
+	// managedByLabel marks the ConfigMaps kic creates for itself.
+	managedByLabel = "app.kubernetes.io/managed-by"
+)
+
+// retryOnConflict runs fn again whenever it fails on a resourceVersion
+// conflict, so that fn re-reads the object, renders the records into it
+// again and writes on top of the concurrent change instead of overwriting it.
+// fn reads through the cache at first, then through the API server: the cache
+// likely still holds the version that just lost.
+func (r *IngressReconciler) retryOnConflict(fn func(reader client.Reader) error) error {
+	var reader client.Reader = r.Client
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		err := fn(reader)
+		reader = r.apiReader()
+		return err
+	})
+}
+
+// writeConfigMap writes the given keys of a ConfigMap read beforehand,
+// creating it if it has no resourceVersion. With ServerSideApply the keys are
+// applied instead, with kic as the owner of the keys, forcing conflicting
+// owners out, and the other keys are left to their owners. Every key kic
+// writes must be given: applying without one gives it up and deletes it.
+func (r *IngressReconciler) writeConfigMap(ctx context.Context, configMap *corev1.ConfigMap, keys ...string) error {
+	if !r.ServerSideApply {
+		if configMap.ResourceVersion == "" {
+			return r.Create(ctx, configMap, client.FieldOwner(fieldOwner))
+		}
+		return r.Update(ctx, configMap, client.FieldOwner(fieldOwner))
+	}
+
+	applied := &corev1.ConfigMap{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+		ObjectMeta: metav1.ObjectMeta{Name: configMap.Name, Namespace: configMap.Namespace},
+		Data:       make(map[string]string, len(keys)),
+	}
+	if configMap.Labels[managedByLabel] == fieldOwner {
+		applied.Labels = map[string]string{managedByLabel: fieldOwner}
+	}
+	for _, key := range keys {
+		applied.Data[key] = configMap.Data[key]
+	}
+	if err := r.Patch(ctx, applied, client.Apply, client.FieldOwner(fieldOwner), client.ForceOwnership); err != nil {
+		return err
+	}
+	configMap.ResourceVersion = applied.ResourceVersion
+	return nil
+}
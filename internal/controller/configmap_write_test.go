@@ -0,0 +1,195 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+func TestUpdateDNSRetriesOnConflict(t *testing.T) {
+	const target = "ingress-nginx-controller.ingress-nginx.svc.cluster.local"
+	web := newIngress("apps", "web", "www.example.com")
+	coreDNS := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: coreDNSConfigMapName, Namespace: coreDNSConfigMapNamespace},
+		Data:       map[string]string{corefileKey: ".:53 {\n    kubernetes cluster.local\n}\n"},
+	}
+
+	updates := 0
+	c := newFakeClientBuilder(t).
+		WithObjects(&web, coreDNS).
+		WithInterceptorFuncs(interceptor.Funcs{
+			Update: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.UpdateOption) error {
+				updates++
+				if updates == 1 {
+					// Someone else writes another key in between kic's read and write
+					var current corev1.ConfigMap
+					if err := c.Get(ctx, client.ObjectKeyFromObject(obj), &current); err != nil {
+						return err
+					}
+					current.Data["extra.server"] = "example.org:53 {\n    forward . 192.0.2.53\n}\n"
+					if err := c.Update(ctx, &current); err != nil {
+						return err
+					}
+				}
+				return c.Update(ctx, obj, opts...)
+			},
+		}).
+		Build()
+	r := &IngressReconciler{Client: c, Log: logr.Discard(), IngressControllerServiceName: target}
+	if err := r.updateDNS(context.Background()); err != nil {
+		t.Fatalf("updateDNS() returned error: %v", err)
+	}
+	if updates != 2 {
+		t.Errorf("expected the conflicting update to be retried, got %d updates", updates)
+	}
+
+	var updated corev1.ConfigMap
+	if err := c.Get(context.Background(), client.ObjectKeyFromObject(coreDNS), &updated); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := updated.Data["extra.server"]; !ok {
+		t.Errorf("expected the concurrent change to be kept, got keys %v", updated.Data)
+	}
+	if !strings.Contains(updated.Data[corefileKey], "rewrite name www.example.com "+target) {
+		t.Errorf("expected the rules in the Corefile:\n%s", updated.Data[corefileKey])
+	}
+}
+
+func TestUpdateDNSRetriesFromTheAPIServer(t *testing.T) {
+	const target = "ingress-nginx-controller.ingress-nginx.svc.cluster.local"
+	tests := []struct {
+		name       string
+		reconciler *IngressReconciler
+		configMap  string
+	}{
+		{name: "coredns", reconciler: &IngressReconciler{}, configMap: coreDNSConfigMapName},
+		{name: "kube-dns", reconciler: &IngressReconciler{DNSProvider: ProviderKubeDNS}, configMap: kubeDNSConfigMapName},
+		{name: "node-local-dns", reconciler: &IngressReconciler{NodeLocalDNS: true}, configMap: nodeLocalDNSConfigMapName},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			web := newIngress("apps", "web", "www.example.com")
+			configMaps := []client.Object{
+				&corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{Name: coreDNSConfigMapName, Namespace: coreDNSConfigMapNamespace},
+					Data:       map[string]string{corefileKey: ".:53 {\n    kubernetes cluster.local\n}\n"},
+				},
+				&corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{Name: kubeDNSConfigMapName, Namespace: coreDNSConfigMapNamespace},
+					Data:       map[string]string{"stubDomains": `{"corp.internal": ["10.0.0.10"]}`},
+				},
+				&corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{Name: nodeLocalDNSConfigMapName, Namespace: coreDNSConfigMapNamespace},
+					Data:       map[string]string{corefileKey: nodeLocalDNSCorefile},
+				},
+			}
+			apiReader := newFakeClientBuilder(t).
+				WithObjects(&web, newService("ingress-nginx", "ingress-nginx-controller", "10.96.0.10")).
+				WithObjects(configMaps...).
+				Build()
+
+			// The cache lags behind someone else's change, and keeps returning
+			// the version the first write conflicts with
+			key := client.ObjectKey{Namespace: coreDNSConfigMapNamespace, Name: tt.configMap}
+			var stale corev1.ConfigMap
+			if err := apiReader.Get(context.Background(), key, &stale); err != nil {
+				t.Fatal(err)
+			}
+			current := stale.DeepCopy()
+			current.Data["extra.server"] = "example.org:53 {\n    forward . 192.0.2.53\n}\n"
+			if err := apiReader.Update(context.Background(), current); err != nil {
+				t.Fatal(err)
+			}
+			c := interceptor.NewClient(apiReader, interceptor.Funcs{
+				Get: func(ctx context.Context, c client.WithWatch, k client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+					if configMap, ok := obj.(*corev1.ConfigMap); ok && k == key {
+						stale.DeepCopyInto(configMap)
+						return nil
+					}
+					return c.Get(ctx, k, obj, opts...)
+				},
+			})
+
+			r := tt.reconciler
+			r.Client, r.APIReader, r.Log = c, apiReader, logr.Discard()
+			r.ClusterDomain, r.IngressControllerServiceName = "cluster.local", target
+			if err := r.updateDNS(context.Background()); err != nil {
+				t.Fatalf("updateDNS() returned error: %v", err)
+			}
+
+			var updated corev1.ConfigMap
+			if err := apiReader.Get(context.Background(), key, &updated); err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := updated.Data["extra.server"]; !ok {
+				t.Errorf("expected the concurrent change to be kept, got keys %v", updated.Data)
+			}
+			if !strings.Contains(fmt.Sprint(updated.Data), "www.example.com") {
+				t.Errorf("expected the rules to be written, got %v", updated.Data)
+			}
+		})
+	}
+}
+
+func TestUpdateDNSWithServerSideApply(t *testing.T) {
+	const target = "ingress-nginx-controller.ingress-nginx.svc.cluster.local"
+	web := newIngress("apps", "web", "www.example.com")
+	coreDNS := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: coreDNSConfigMapName, Namespace: coreDNSConfigMapNamespace},
+		Data: map[string]string{
+			corefileKey:    ".:53 {\n    kubernetes cluster.local\n}\n",
+			"extra.server": "example.org:53 {\n    forward . 192.0.2.53\n}\n",
+		},
+	}
+
+	var applied []*corev1.ConfigMap
+	c := newFakeClientBuilder(t).
+		WithObjects(&web, coreDNS).
+		WithInterceptorFuncs(interceptor.Funcs{
+			Update: func(context.Context, client.WithWatch, client.Object, ...client.UpdateOption) error {
+				return errors.NewBadRequest("expected server-side apply")
+			},
+			Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+				if _, ok := obj.(*corev1.ConfigMap); !ok {
+					return c.Patch(ctx, obj, patch, opts...)
+				}
+				if patch.Type() != types.ApplyPatchType {
+					return errors.NewBadRequest("expected server-side apply")
+				}
+				patchOpts := (&client.PatchOptions{}).ApplyOptions(opts)
+				if patchOpts.FieldManager != fieldOwner || patchOpts.Force == nil || !*patchOpts.Force {
+					return errors.NewConflict(schema.GroupResource{Resource: "configmaps"}, obj.GetName(), nil)
+				}
+				applied = append(applied, obj.(*corev1.ConfigMap).DeepCopy())
+				return nil
+			},
+		}).
+		Build()
+	r := &IngressReconciler{Client: c, Log: logr.Discard(), IngressControllerServiceName: target, ServerSideApply: true}
+	if err := r.updateDNS(context.Background()); err != nil {
+		t.Fatalf("updateDNS() returned error: %v", err)
+	}
+
+	if len(applied) != 1 {
+		t.Fatalf("expected a single apply, got %d", len(applied))
+	}
+	if len(applied[0].Data) != 1 {
+		t.Errorf("expected only the Corefile key to be applied, got keys %v", applied[0].Data)
+	}
+	if !strings.Contains(applied[0].Data[corefileKey], "rewrite name www.example.com "+target) {
+		t.Errorf("expected the rules in the applied Corefile:\n%s", applied[0].Data[corefileKey])
+	}
+	if applied[0].Kind != "ConfigMap" || applied[0].APIVersion != "v1" {
+		t.Errorf("expected the applied object to carry its type, got %v", applied[0].TypeMeta)
+	}
+}
@@ -0,0 +1,133 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// priorityAnnotation lets an object win host conflicts regardless of its age.
+	// Higher values win; objects without it have priority 0.
+	priorityAnnotation = "kic.pelo.tech/priority"
+
+	// reasonHostConflict is the event reason used when a host is claimed by another object.
+	reasonHostConflict = "HostConflict"
+)
+
+// ruleConflict records a rule that was dropped in favour of another rule for the same host.
+type ruleConflict struct {
+	Loser  rewriteRule
+	Winner rewriteRule
+}
+
+// rulePriority returns the value of the priorityAnnotation of the rule's source.
+func rulePriority(rule rewriteRule) int {
+	if rule.Source == nil {
+		return 0
+	}
+	priority, err := strconv.Atoi(rule.Source.GetAnnotations()[priorityAnnotation])
+	if err != nil {
+		return 0
+	}
+	return priority
+}
+
+// outranks reports whether rule a should win a host conflict against rule b:
+// the higher priority wins, then the oldest source, then the source key as a
+// stable tie-breaker.
+func outranks(a, b rewriteRule) bool {
+	if pa, pb := rulePriority(a), rulePriority(b); pa != pb {
+		return pa > pb
+	}
+
+	var ta, tb metav1.Time
+	if a.Source != nil {
+		ta = a.Source.GetCreationTimestamp()
+	}
+	if b.Source != nil {
+		tb = b.Source.GetCreationTimestamp()
+	}
+	if !ta.Equal(&tb) {
+		return ta.Before(&tb)
+	}
+	return sourceKey(a.Source) < sourceKey(b.Source)
+}
+
+// sameRewrite reports whether two rules produce the same Corefile directive.
+func sameRewrite(a, b rewriteRule) bool {
+	return a.Target == b.Target && slices.Equal(a.IPs, b.IPs) && a.SuffixMatch == b.SuffixMatch
+}
+
+// pickHostOwners keeps a single rule per host. Identical rules are collapsed
+// into one; rules rewriting the same host differently are resolved with
+// outranks and every dropped rule is returned as a conflict. Hosts keep the
+// order in which they were first seen.
+func pickHostOwners(rules []rewriteRule) ([]rewriteRule, []ruleConflict) {
+	var hosts []string
+	claims := map[string][]rewriteRule{}
+	for _, rule := range rules {
+		host := strings.ToLower(rule.Host)
+		if _, seen := claims[host]; !seen {
+			hosts = append(hosts, host)
+		}
+		claims[host] = append(claims[host], rule)
+	}
+
+	winners := make([]rewriteRule, 0, len(hosts))
+	var conflicts []ruleConflict
+	for _, host := range hosts {
+		winner := claims[host][0]
+		for _, rule := range claims[host][1:] {
+			if outranks(rule, winner) {
+				winner = rule
+			}
+		}
+		for _, rule := range claims[host] {
+			if !sameRewrite(rule, winner) {
+				conflicts = append(conflicts, ruleConflict{Loser: rule, Winner: winner})
+			}
+		}
+		winners = append(winners, winner)
+	}
+	return winners, conflicts
+}
+
+// resolveConflicts resolves host conflicts between rules, logging each
+// conflict and recording a HostConflict event on the losing object when the
+// conflict is new.
+func (r *IngressReconciler) resolveConflicts(rules []rewriteRule) ([]rewriteRule, []ruleConflict) {
+	winners, conflicts := pickHostOwners(rules)
+	for _, conflict := range conflicts {
+		r.Log.Info("Host claimed by more than one object, keeping the winner",
+			"host", conflict.Loser.Host, "winner", sourceKey(conflict.Winner.Source), "loser", sourceKey(conflict.Loser.Source))
+		if conflict.Loser.Source != nil {
+			r.recordWarning(conflict.Loser.Source, reasonHostConflict, "Host not rewritten: %s", conflict.message())
+		}
+	}
+	return winners, conflicts
+}
+
+// message describes why the losing rule of a conflict was dropped.
+func (c ruleConflict) message() string {
+	return fmt.Sprintf("%q is already rewritten to %s for %s", c.Loser.Host, c.Winner.destination(), sourceKey(c.Winner.Source))
+}
@@ -0,0 +1,265 @@
+package controller
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestPickHostOwners(t *testing.T) {
+	const (
+		nginx   = "ingress-nginx-controller.ingress-nginx.svc.cluster.local"
+		traefik = "traefik.traefik.svc.cluster.local"
+	)
+	now := time.Now()
+
+	oldest := newIngress("team-a", "web", "www.example.com")
+	oldest.CreationTimestamp = metav1.NewTime(now.Add(-2 * time.Hour))
+	newer := newIngress("team-b", "web", "www.example.com")
+	newer.CreationTimestamp = metav1.NewTime(now.Add(-time.Hour))
+	prioritized := newIngress("team-c", "web", "www.example.com")
+	prioritized.CreationTimestamp = metav1.NewTime(now)
+	prioritized.Annotations = map[string]string{priorityAnnotation: "10"}
+
+	tests := []struct {
+		name              string
+		rules             []rewriteRule
+		expectedWinners   []rewriteRule
+		expectedConflicts int
+	}{
+		{
+			name: "identical rules are collapsed",
+			rules: []rewriteRule{
+				{Host: "www.example.com", Target: nginx, Source: &newer},
+				{Host: "www.example.com", Target: nginx, Source: &oldest},
+			},
+			expectedWinners: []rewriteRule{{Host: "www.example.com", Target: nginx, Source: &oldest}},
+		},
+		{
+			name: "oldest source wins",
+			rules: []rewriteRule{
+				{Host: "www.example.com", Target: traefik, Source: &newer},
+				{Host: "www.example.com", Target: nginx, Source: &oldest},
+			},
+			expectedWinners:   []rewriteRule{{Host: "www.example.com", Target: nginx, Source: &oldest}},
+			expectedConflicts: 1,
+		},
+		{
+			name: "priority annotation wins over age",
+			rules: []rewriteRule{
+				{Host: "www.example.com", Target: nginx, Source: &oldest},
+				{Host: "www.example.com", Target: traefik, Source: &prioritized},
+				{Host: "www.example.com", Target: nginx, Source: &newer},
+			},
+			expectedWinners:   []rewriteRule{{Host: "www.example.com", Target: traefik, Source: &prioritized}},
+			expectedConflicts: 2,
+		},
+		{
+			name: "hosts keep their first-seen order",
+			rules: []rewriteRule{
+				{Host: "b.example.com", Target: nginx, Source: &oldest},
+				{Host: "a.example.com", Target: nginx, Source: &oldest},
+				{Host: "B.example.com", Target: nginx, Source: &newer},
+			},
+			expectedWinners: []rewriteRule{
+				{Host: "b.example.com", Target: nginx, Source: &oldest},
+				{Host: "a.example.com", Target: nginx, Source: &oldest},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			winners, conflicts := pickHostOwners(tt.rules)
+			if !reflect.DeepEqual(winners, tt.expectedWinners) {
+				t.Errorf("pickHostOwners() winners:\nExpected: %v\nActual:   %v", tt.expectedWinners, winners)
+			}
+			if len(conflicts) != tt.expectedConflicts {
+				t.Errorf("pickHostOwners(): expected %d conflicts, got %d", tt.expectedConflicts, len(conflicts))
+			}
+		})
+	}
+}
+
+func TestSyncIngressConditions(t *testing.T) {
+	winner := newIngress("team-a", "web", "www.example.com")
+	loser := newIngress("team-b", "web", "www.example.com")
+	resolved := newIngress("team-c", "web", "old.example.com")
+	resolved.Annotations = map[string]string{
+		statusAnnotation: `[{"type":"HostConflict","status":"True","reason":"HostConflict","message":"stale",` +
+			`"lastTransitionTime":"2025-01-01T00:00:00Z"}]`,
+	}
+
+	c := newFakeClient(t, &winner, &loser, &resolved)
+	var list networkingv1.IngressList
+	if err := c.List(context.Background(), &list); err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := record.NewFakeRecorder(10)
+	r := &IngressReconciler{Client: c, Recorder: recorder}
+
+	var rules []rewriteRule
+	for i := range list.Items {
+		if list.Items[i].Namespace == "team-c" {
+			continue
+		}
+		target := "nginx.ingress-nginx.svc.cluster.local"
+		if list.Items[i].Namespace == "team-b" {
+			target = "traefik.traefik.svc.cluster.local"
+		}
+		rules = append(rules, rewriteRule{Host: "www.example.com", Target: target, Source: &list.Items[i]})
+	}
+
+	winners, conflicts := r.resolveConflicts(rules)
+	if err := r.syncIngressConditions(context.Background(), list.Items, winners, nil, conflicts); err != nil {
+		t.Fatalf("syncIngressConditions() returned error: %v", err)
+	}
+
+	if event := <-recorder.Events; !strings.HasPrefix(event, "Warning "+reasonHostConflict) {
+		t.Errorf("unexpected event %q", event)
+	}
+	expectedEvent := "Normal " + reasonRewriteApplied + " Hosts rewritten: www.example.com -> nginx.ingress-nginx.svc.cluster.local"
+	if event := <-recorder.Events; event != expectedEvent {
+		t.Errorf("unexpected event %q, expected %q", event, expectedEvent)
+	}
+
+	expectations := map[string]struct {
+		conflicted bool
+		rewrites   string
+	}{
+		"team-a": {rewrites: "www.example.com -> nginx.ingress-nginx.svc.cluster.local"},
+		"team-b": {conflicted: true},
+		"team-c": {},
+	}
+	for namespace, expected := range expectations {
+		var ingress networkingv1.Ingress
+		if err := c.Get(context.Background(), client.ObjectKey{Namespace: namespace, Name: "web"}, &ingress); err != nil {
+			t.Fatal(err)
+		}
+		conditions := ingressConditions(&ingress)
+		if conflicted := meta.IsStatusConditionTrue(conditions, conditionHostConflict); conflicted != expected.conflicted {
+			t.Errorf("%s: expected conflict condition %v, got %v", namespace, expected.conflicted, conditions)
+		}
+		if conflicted := meta.FindStatusCondition(conditions, conditionHostConflict) != nil; conflicted != expected.conflicted {
+			t.Errorf("%s: expected a resolved conflict condition to be removed, got %v", namespace, conditions)
+		}
+		applied := meta.FindStatusCondition(conditions, conditionRewriteApplied)
+		switch {
+		case applied == nil:
+			t.Errorf("%s: expected a RewriteApplied condition, got %v", namespace, conditions)
+		case expected.rewrites != "" && (applied.Status != metav1.ConditionTrue || applied.Message != expected.rewrites):
+			t.Errorf("%s: expected rewrites %q, got %v", namespace, expected.rewrites, applied)
+		case expected.rewrites == "" && (applied.Status != metav1.ConditionFalse || applied.Reason != reasonNoHostsRewritten):
+			t.Errorf("%s: expected no rewrites, got %v", namespace, applied)
+		}
+	}
+
+	// Nothing changed, so no event is recorded again
+	if err := c.List(context.Background(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.syncIngressConditions(context.Background(), list.Items, winners, nil, nil); err != nil {
+		t.Fatalf("syncIngressConditions() returned error: %v", err)
+	}
+	select {
+	case event := <-recorder.Events:
+		t.Errorf("unexpected event %q", event)
+	default:
+	}
+}
+
+func TestSyncIngressConditionsFilteredIngress(t *testing.T) {
+	ignored := newIngress("apps", "web", "www.example.com")
+	c := newFakeClient(t, &ignored)
+	r := &IngressReconciler{Client: c, IngressAnnotation: "kic"}
+	if err := r.syncIngressConditions(context.Background(), []networkingv1.Ingress{ignored}, nil, nil, nil); err != nil {
+		t.Fatalf("syncIngressConditions() returned error: %v", err)
+	}
+
+	var ingress networkingv1.Ingress
+	if err := c.Get(context.Background(), client.ObjectKeyFromObject(&ignored), &ingress); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := ingress.Annotations[statusAnnotation]; ok {
+		t.Errorf("expected Ingresses left out by the annotation filter to get no status, got %v", ingress.Annotations)
+	}
+}
+
+func TestUpdateDNSRecordsWarningsOnce(t *testing.T) {
+	winner := newIngress("team-a", "web", "www.example.com")
+	winner.CreationTimestamp = metav1.NewTime(time.Now().Add(-time.Hour))
+	loser := newIngress("team-b", "web", "www.example.com", "api.cluster.local")
+	loser.Annotations = map[string]string{targetAnnotation: "traefik.traefik.svc.cluster.local"}
+	coreDNS := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: coreDNSConfigMapName, Namespace: coreDNSConfigMapNamespace},
+		Data:       map[string]string{corefileKey: ".:53 {\n    kubernetes cluster.local\n}\n"},
+	}
+	c := newFakeClient(t, &winner, &loser, coreDNS)
+	recorder := record.NewFakeRecorder(100)
+	r := &IngressReconciler{
+		Client:                       c,
+		Log:                          logr.Discard(),
+		Recorder:                     recorder,
+		IngressControllerServiceName: "nginx.ingress-nginx.svc.cluster.local",
+		ProtectedDomains:             []string{"cluster.local"},
+	}
+
+	warnings := func() []string {
+		var reasons []string
+		for {
+			select {
+			case event := <-recorder.Events:
+				if reason, ok := strings.CutPrefix(event, "Warning "); ok {
+					reasons = append(reasons, strings.Fields(reason)[0])
+				}
+			default:
+				sort.Strings(reasons)
+				return reasons
+			}
+		}
+	}
+	updateDNS := func() {
+		t.Helper()
+		if err := r.updateDNS(context.Background()); err != nil {
+			t.Fatalf("updateDNS() returned error: %v", err)
+		}
+	}
+
+	updateDNS()
+	if got, expected := warnings(), []string{reasonHostConflict, reasonHostRejected}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("first rebuild: expected warnings %v, got %v", expected, got)
+	}
+	updateDNS()
+	if got := warnings(); len(got) != 0 {
+		t.Errorf("second rebuild: expected no warning for the persistent problems, got %v", got)
+	}
+
+	// The conflict goes away, then comes back
+	if err := c.Delete(context.Background(), &winner); err != nil {
+		t.Fatal(err)
+	}
+	updateDNS()
+	if got := warnings(); len(got) != 0 {
+		t.Errorf("resolved conflict: expected no warning, got %v", got)
+	}
+	winner.ResourceVersion = ""
+	if err := c.Create(context.Background(), &winner); err != nil {
+		t.Fatal(err)
+	}
+	updateDNS()
+	if got, expected := warnings(), []string{reasonHostConflict}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("returning conflict: expected warnings %v, got %v", expected, got)
+	}
+}
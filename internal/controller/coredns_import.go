@@ -0,0 +1,146 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/pelotech/kic/internal/corefile"
+)
+
+const (
+	// managedConfigMapKey is the file of the managed ConfigMap holding the rules.
+	managedConfigMapKey = "kic.override"
+	// managedConfigMapHeader starts the managed file so it is recognisable when mounted.
+	managedConfigMapHeader = "# Managed by kic, changes are overwritten.\n"
+	// DefaultCoreDNSImportPath is where the managed ConfigMap is expected to be mounted
+	// in the CoreDNS pods.
+	DefaultCoreDNSImportPath = "/etc/coredns/kic/*.override"
+)
+
+// getManagedConfigMap reads the managed ConfigMap from reader. A ConfigMap
+// that does not exist yet is returned without a resourceVersion, for
+// updateManagedConfigMap to create.
+func (r *IngressReconciler) getManagedConfigMap(ctx context.Context, reader client.Reader) (*corev1.ConfigMap, error) {
+	key := client.ObjectKey{Namespace: coreDNSConfigMapNamespace, Name: r.ManagedConfigMapName}
+	var configMap corev1.ConfigMap
+	if err := reader.Get(ctx, key, &configMap); err != nil {
+		if !errors.IsNotFound(err) {
+			return nil, err
+		}
+		return &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      key.Name,
+				Namespace: key.Namespace,
+				Labels:    map[string]string{managedByLabel: fieldOwner},
+			},
+		}, nil
+	}
+	return &configMap, nil
+}
+
+// updateManagedConfigMap writes files into the managed ConfigMap, or another
+// ConfigMap kic writes to, creating it if it does not exist yet. Other keys
+// are kept, and the ConfigMap is left alone when no file changed.
+func (r *IngressReconciler) updateManagedConfigMap(ctx context.Context, configMap *corev1.ConfigMap, files map[string]string) error {
+	changed := false
+	for key, content := range files {
+		if existing, ok := configMap.Data[key]; ok && corefilesEquivalent(existing, content) {
+			continue
+		}
+		if configMap.Data == nil {
+			configMap.Data = map[string]string{}
+		}
+		configMap.Data[key] = content
+		changed = true
+	}
+
+	if configMap.ResourceVersion != "" && !changed {
+		return nil
+	}
+	keys := make([]string, 0, len(files))
+	for key := range files {
+		keys = append(keys, key)
+	}
+	return r.writeConfigMap(ctx, configMap, keys...)
+}
+
+// ensureImport makes the target server blocks import the managed ConfigMap's
+// files. The import line is only added once; managed blocks left from
+// injecting rules into the Corefile itself are removed. The metadata plugin is
+// enabled alongside the import when the rules need it. Like
+// injectRewriteRules, it refuses to import a hosts block into a server block
+// that already uses the hosts plugin, which CoreDNS would reject.
+func (r *IngressReconciler) ensureImport(corefileContent string, rules string) (string, error) {
+	parsed, err := corefile.Parse(corefileContent)
+	if err != nil {
+		return "", fmt.Errorf("unable to parse Corefile: %w", err)
+	}
+	managedBlock, needsMetadata, err := newManagedBlock(rules)
+	if err != nil {
+		return "", err
+	}
+
+	targets, err := r.configuredServerBlocks(parsed)
+	if err != nil {
+		return "", err
+	}
+	if len(targets) == 0 {
+		block := defaultServerBlock(parsed)
+		if block == nil {
+			return "", fmt.Errorf("no server block to import %s into", r.CoreDNSImportPath)
+		}
+		targets = append(targets, block)
+	}
+	if err := removeManagedBlocksExcept(parsed, nil); err != nil {
+		return "", err
+	}
+	if countPlugin(managedBlock, "hosts") > 0 {
+		for _, block := range targets {
+			if countPlugin(block.Block, "hosts") > 0 {
+				return "", fmt.Errorf("server block %q already uses the hosts plugin", strings.Join(block.Keys(), " "))
+			}
+		}
+	}
+
+	for _, block := range targets {
+		if !importsPath(block, r.CoreDNSImportPath) {
+			insertManagedBlock(block, []*corefile.Node{corefile.NewDirective("import", r.CoreDNSImportPath)})
+		}
+		if needsMetadata {
+			ensureMetadata(parsed, block)
+		}
+	}
+	return printCorefile(parsed), nil
+}
+
+// importsPath reports whether a server block already imports the given path.
+func importsPath(block *corefile.Node, path string) bool {
+	for _, node := range block.Block {
+		if node.Name == "import" && len(node.Args) == 1 && node.Args[0] == path {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,143 @@
+package controller
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+func TestUpdateCoreDNSConfigMapWithManagedConfigMap(t *testing.T) {
+	const target = "ingress-nginx-controller.ingress-nginx.svc.cluster.local"
+
+	web := newIngress("apps", "web", "www.example.com")
+	coreDNS := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: coreDNSConfigMapName, Namespace: coreDNSConfigMapNamespace},
+		Data: map[string]string{corefileKey: ".:53 {\n" +
+			"    errors\n" +
+			"    kubernetes cluster.local in-addr.arpa ip6.arpa\n" +
+			"    " + managedRulesBeginMarker + "\n" +
+			"    rewrite name old.example.com " + target + "\n" +
+			"    " + managedRulesEndMarker + "\n" +
+			"    forward . /etc/resolv.conf\n" +
+			"}\n"},
+	}
+
+	writes := map[string]int{}
+	count := func(obj client.Object) { writes[obj.GetName()]++ }
+	c := newFakeClientBuilder(t).
+		WithObjects(&web, coreDNS).
+		WithInterceptorFuncs(interceptor.Funcs{
+			Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+				count(obj)
+				return c.Create(ctx, obj, opts...)
+			},
+			Update: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.UpdateOption) error {
+				count(obj)
+				return c.Update(ctx, obj, opts...)
+			},
+		}).
+		Build()
+	r := &IngressReconciler{
+		Client:                       c,
+		IngressControllerServiceName: target,
+		ManagedConfigMapName:         "coredns-kic",
+		CoreDNSImportPath:            DefaultCoreDNSImportPath,
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := r.updateDNS(context.Background()); err != nil {
+			t.Fatalf("updateDNS() returned error: %v", err)
+		}
+	}
+	if writes[coreDNSConfigMapName] != 1 || writes["coredns-kic"] != 1 {
+		t.Errorf("expected a single write per ConfigMap, got %v", writes)
+	}
+
+	var managed corev1.ConfigMap
+	if err := c.Get(context.Background(), client.ObjectKey{Namespace: coreDNSConfigMapNamespace, Name: "coredns-kic"}, &managed); err != nil {
+		t.Fatal(err)
+	}
+	if expected := managedConfigMapHeader + "rewrite name www.example.com " + target + "\n"; managed.Data[managedConfigMapKey] != expected {
+		t.Errorf("unexpected managed ConfigMap content:\n%s", managed.Data[managedConfigMapKey])
+	}
+
+	var updated corev1.ConfigMap
+	if err := c.Get(context.Background(), client.ObjectKeyFromObject(coreDNS), &updated); err != nil {
+		t.Fatal(err)
+	}
+	expectedCorefile := ".:53 {\n" +
+		"    errors\n" +
+		"    kubernetes cluster.local in-addr.arpa ip6.arpa\n" +
+		"    import " + DefaultCoreDNSImportPath + "\n" +
+		"    forward . /etc/resolv.conf\n" +
+		"}\n"
+	if updated.Data[corefileKey] != expectedCorefile {
+		t.Errorf("unexpected Corefile:\n%s", updated.Data[corefileKey])
+	}
+
+	// New hosts only touch the managed ConfigMap.
+	api := newIngress("apps", "api", "api.example.com")
+	if err := c.Create(context.Background(), &api); err != nil {
+		t.Fatal(err)
+	}
+	writes = map[string]int{}
+	if err := r.updateDNS(context.Background()); err != nil {
+		t.Fatalf("updateDNS() returned error: %v", err)
+	}
+	if writes[coreDNSConfigMapName] != 0 || writes["coredns-kic"] != 1 {
+		t.Errorf("expected only the managed ConfigMap to be written, got %v", writes)
+	}
+}
+
+func TestEnsureImport(t *testing.T) {
+	const importPath = "/etc/coredns/custom/*.override"
+	corefile := ".:53 {\n" +
+		"    errors\n" +
+		"    kubernetes cluster.local in-addr.arpa ip6.arpa\n" +
+		"    import " + importPath + "\n" +
+		"}\n" +
+		"corp.internal:53 {\n" +
+		"    forward . 10.0.0.10\n" +
+		"}\n"
+
+	r := &IngressReconciler{CoreDNSServerBlocks: []string{".:53", "corp.internal:53"}, CoreDNSImportPath: importPath}
+	actual, err := r.ensureImport(corefile, "expression \"a\" {\n    rewrite name a.example.com b.svc\n}\n")
+	if err != nil {
+		t.Fatalf("ensureImport() returned error: %v", err)
+	}
+	expected := ".:53 {\n" +
+		"    errors\n" +
+		"    metadata\n" +
+		"    kubernetes cluster.local in-addr.arpa ip6.arpa\n" +
+		"    import " + importPath + "\n" +
+		"}\n" +
+		"corp.internal:53 {\n" +
+		"    forward . 10.0.0.10\n" +
+		"    metadata\n" +
+		"    import " + importPath + "\n" +
+		"}\n"
+	if actual != expected {
+		t.Errorf("ensureImport():\nExpected:\n%s\nActual:\n%s", expected, actual)
+	}
+
+	// The imported hosts block would be a second hosts plugin in the server block
+	withHosts := ".:53 {\n    hosts /etc/coredns/NodeHosts {\n        fallthrough\n    }\n    kubernetes cluster.local\n}\n"
+	r.CoreDNSServerBlocks = nil
+	hostsRules := "hosts {\n    10.96.0.10 a.example.com\n    fallthrough\n}\n"
+	if _, err := r.ensureImport(withHosts, hostsRules); err == nil || !strings.Contains(err.Error(), "hosts plugin") {
+		t.Errorf("expected an error for a second hosts plugin, got %v", err)
+	}
+	if _, err := r.ensureImport(withHosts, "rewrite name a.example.com b.svc\n"); err != nil {
+		t.Errorf("ensureImport() returned error for rules without a hosts block: %v", err)
+	}
+
+	r.CoreDNSServerBlocks = []string{"missing.example.com"}
+	if _, err := r.ensureImport(corefile, ""); err == nil || !strings.Contains(err.Error(), "missing.example.com") {
+		t.Errorf("expected an error for a missing server block, got %v", err)
+	}
+}
@@ -0,0 +1,163 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// coreDNSProvider writes the records into the coredns ConfigMap, as rules of
+// the configured Backend, or into the managed ConfigMap the Corefile imports.
+// It is configured through the CoreDNS fields of the IngressReconciler.
+type coreDNSProvider struct {
+	*IngressReconciler
+}
+
+// Apply renders the records and updates the ConfigMaps, leaving them alone
+// when nothing changed beyond formatting. A write losing to a concurrent
+// change is retried from a fresh read.
+func (p *coreDNSProvider) Apply(ctx context.Context, records []rewriteRule) (Applied, error) {
+	var applied Applied
+	err := p.retryOnConflict(func(reader client.Reader) error {
+		var err error
+		applied, err = p.apply(ctx, reader, records)
+		return err
+	})
+	return applied, err
+}
+
+// apply reads the ConfigMaps from reader, injects the rendered records and
+// writes them back.
+func (p *coreDNSProvider) apply(ctx context.Context, reader client.Reader, records []rewriteRule) (Applied, error) {
+	log := p.Log.WithName("coredns-updater")
+
+	// Get the CoreDNS configmap
+	var coreDNSConfigMap corev1.ConfigMap
+	if err := reader.Get(ctx, client.ObjectKey{Namespace: coreDNSConfigMapNamespace, Name: coreDNSConfigMapName}, &coreDNSConfigMap); err != nil {
+		log.Error(err, "unable to fetch CoreDNS ConfigMap")
+		return Applied{}, err
+	}
+	originalCorefile := coreDNSConfigMap.Data[corefileKey]
+
+	// The rules live either in the Corefile, or in kic's own ConfigMap which the Corefile imports
+	var managedConfigMap *corev1.ConfigMap
+	filesSource := coreDNSConfigMap.Data
+	if p.ManagedConfigMapName != "" {
+		var err error
+		if managedConfigMap, err = p.getManagedConfigMap(ctx, reader); err != nil {
+			log.Error(err, "unable to fetch the managed ConfigMap", "configMap", p.ManagedConfigMapName)
+			return Applied{}, err
+		}
+		filesSource = managedConfigMap.Data
+	}
+
+	// files are written next to the rules, such as the zone file of the file backend
+	files := map[string]string{}
+	rulesString := renderRewriteRules(records)
+	switch p.Backend {
+	case BackendHosts:
+		var err error
+		if rulesString, err = p.renderHostsRules(ctx, records); err != nil {
+			log.Error(err, "unable to render hosts entries")
+			return Applied{}, err
+		}
+	case BackendFile:
+		var zoneFile string
+		var err error
+		if rulesString, zoneFile, err = p.renderZoneRules(ctx, records, filesSource[p.zoneFileKey()], time.Now()); err != nil {
+			log.Error(err, "unable to render the zone file", "zone", p.Zone)
+			return Applied{}, err
+		}
+		files[p.zoneFileKey()] = zoneFile
+	}
+	// If there are excluded namespaces, wrap the rules in an expression
+	if len(p.CoreDNSExcludedNamespaces) > 0 && rulesString != "" {
+		// Format each namespace as a quoted string
+		quotedNamespaces := make([]string, len(p.CoreDNSExcludedNamespaces))
+		for i, ns := range p.CoreDNSExcludedNamespaces {
+			quotedNamespaces[i] = fmt.Sprintf("'%s'", ns)
+		}
+		// Create the CEL expression
+		expression := fmt.Sprintf("!(label('kubernetes/client-namespace') in [%s])", strings.Join(quotedNamespaces, ", "))
+		// Wrap the rules in the expression block
+		rulesString = fmt.Sprintf("expression \"%s\" {\n%s}\n", expression, strings.TrimSpace(rulesString))
+	}
+
+	var updatedCorefile string
+	var err error
+	if managedConfigMap != nil {
+		files[managedConfigMapKey] = managedConfigMapHeader + rulesString
+		updatedCorefile, err = p.ensureImport(originalCorefile, rulesString)
+	} else {
+		updatedCorefile, err = p.injectRewriteRules(originalCorefile, rulesString)
+	}
+	if err != nil {
+		log.Error(err, "unable to inject rewrite rules into the Corefile")
+		return Applied{}, err
+	}
+
+	var configured, desired strings.Builder
+	configured.WriteString(originalCorefile)
+	desired.WriteString(updatedCorefile)
+	for key, content := range files {
+		configured.WriteString(filesSource[key])
+		desired.WriteString(content)
+	}
+	// The zone file serial is left out of the rendered records, as it is
+	// bumped whenever the configured zone file differs
+	applied := Applied{
+		Drift:    lineDrift(configured.String(), desired.String()),
+		Rendered: rulesString + withoutZoneSerial(files[p.zoneFileKey()]),
+	}
+
+	if managedConfigMap != nil {
+		if err := p.updateManagedConfigMap(ctx, managedConfigMap, files); err != nil {
+			log.Error(err, "unable to update the managed ConfigMap", "configMap", p.ManagedConfigMapName)
+			return Applied{}, err
+		}
+		files = nil
+	}
+
+	// Only update if the content has changed
+	changed := !corefilesEquivalent(originalCorefile, updatedCorefile)
+	keys := []string{corefileKey}
+	for key, content := range files {
+		keys = append(keys, key)
+		if coreDNSConfigMap.Data[key] != content {
+			coreDNSConfigMap.Data[key] = content
+			changed = true
+		}
+	}
+	if !changed {
+		log.Info("CoreDNS rewrite rules are already up to date.")
+		return applied, nil
+	}
+
+	coreDNSConfigMap.Data[corefileKey] = updatedCorefile
+	if err := p.writeConfigMap(ctx, &coreDNSConfigMap, keys...); err != nil {
+		log.Error(err, "unable to update CoreDNS ConfigMap")
+		return Applied{}, err
+	}
+	log.Info("Successfully updated CoreDNS ConfigMap with new rewrite rules")
+	return applied, nil
+}
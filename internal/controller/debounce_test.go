@@ -0,0 +1,109 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/workqueue"
+	testingclock "k8s.io/utils/clock/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// TestDebouncedBurst rolls out 300 Ingresses in batches of 30, letting the
+// worker drain the queue between batches as it would while the burst is still
+// going, and counts the rebuilds and ConfigMap writes it causes. The queue
+// runs on a fake clock, so the whole burst falls within the debounce window
+// however slowly it runs.
+func TestDebouncedBurst(t *testing.T) {
+	const (
+		ingresses = 300
+		batch     = 30
+	)
+	tests := []struct {
+		name             string
+		debounce         time.Duration
+		expectedRebuilds int
+		expectedWrites   int
+	}{
+		{name: "no debounce", debounce: 0, expectedRebuilds: ingresses / batch, expectedWrites: ingresses / batch},
+		{name: "burst within the window", debounce: 500 * time.Millisecond, expectedRebuilds: 1, expectedWrites: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			coreDNS := &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: coreDNSConfigMapName, Namespace: coreDNSConfigMapNamespace},
+				Data:       map[string]string{corefileKey: ".:53 {\n    kubernetes cluster.local\n}\n"},
+			}
+			writes := 0
+			c := newFakeClientBuilder(t).
+				WithObjects(coreDNS).
+				WithInterceptorFuncs(interceptor.Funcs{
+					Update: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.UpdateOption) error {
+						if _, ok := obj.(*corev1.ConfigMap); ok {
+							writes++
+						}
+						return c.Update(ctx, obj, opts...)
+					},
+				}).
+				Build()
+			r := &IngressReconciler{Client: c, Log: logr.Discard(), IngressControllerServiceName: "controller.nginx.svc.cluster.local"}
+
+			clock := testingclock.NewFakeClock(time.Now())
+			q := workqueue.NewTypedRateLimitingQueueWithConfig(
+				workqueue.DefaultTypedControllerRateLimiter[reconcile.Request](),
+				workqueue.TypedRateLimitingQueueConfig[reconcile.Request]{Clock: clock},
+			)
+			defer q.ShutDown()
+			handler := enqueueDNSUpdate(tt.debounce)
+			rebuilds := 0
+			drain := func() {
+				for q.Len() > 0 {
+					req, _ := q.Get()
+					if req != dnsUpdateRequest {
+						t.Errorf("unexpected request %v", req)
+					}
+					if _, err := r.Reconcile(context.Background(), req); err != nil {
+						t.Fatalf("Reconcile() returned error: %v", err)
+					}
+					rebuilds++
+					q.Done(req)
+				}
+			}
+
+			for i := 0; i < ingresses; i++ {
+				ingress := newIngress("apps", fmt.Sprintf("app-%d", i), fmt.Sprintf("app-%d.example.com", i))
+				if err := c.Create(context.Background(), &ingress); err != nil {
+					t.Fatal(err)
+				}
+				handler.Create(context.Background(), event.CreateEvent{Object: &ingress}, q)
+				if (i+1)%batch == 0 {
+					drain()
+				}
+			}
+
+			// Close the debounce window, then wait for the queue to move the
+			// pending request over
+			clock.Step(tt.debounce)
+			deadline := time.Now().Add(time.Minute)
+			for q.Len() == 0 && rebuilds < tt.expectedRebuilds && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond)
+			}
+			drain()
+
+			if rebuilds != tt.expectedRebuilds {
+				t.Errorf("expected %d rebuilds, got %d", tt.expectedRebuilds, rebuilds)
+			}
+			if writes != tt.expectedWrites {
+				t.Errorf("expected %d ConfigMap writes, got %d", tt.expectedWrites, writes)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/pelotech/kic/internal/dnsserver"
+)
+
+const (
+	// ProviderEmbedded answers the records from a DNS server run by kic itself.
+	ProviderEmbedded = "embedded"
+
+	// DefaultEmbeddedDNSAddress is where the embedded DNS server listens by default.
+	DefaultEmbeddedDNSAddress = ":5353"
+)
+
+// embeddedProvider keeps the records in memory and answers them from its DNS
+// server, which CoreDNS forwards the Ingress zones to. Nothing in the cluster
+// DNS changes when records do.
+type embeddedProvider struct {
+	*IngressReconciler
+	server *dnsserver.Server
+}
+
+func newEmbeddedProvider(r *IngressReconciler) (DNSProvider, error) {
+	if len(r.CoreDNSExcludedNamespaces) > 0 {
+		return nil, fmt.Errorf("excluded namespaces are not supported by the embedded DNS server")
+	}
+	address := r.EmbeddedDNSAddress
+	if address == "" {
+		address = DefaultEmbeddedDNSAddress
+	}
+	return &embeddedProvider{
+		IngressReconciler: r,
+		server: &dnsserver.Server{
+			Addr:     address,
+			Upstream: r.EmbeddedDNSUpstream,
+			Log:      r.Log.WithName("dns-server"),
+		},
+	}, nil
+}
+
+// Apply answers the records with the ClusterIPs of their target Service, or
+// as an alias of the target when it has none.
+func (p *embeddedProvider) Apply(ctx context.Context, records []rewriteRule) (Applied, error) {
+	served := make([]dnsserver.Record, 0, len(records))
+	for _, record := range records {
+		ips, err := p.ruleIPs(ctx, record)
+		if err != nil {
+			return Applied{}, err
+		}
+		answer := dnsserver.Record{Name: record.Host, SuffixMatch: record.SuffixMatch, Target: record.Target}
+		for _, ip := range ips {
+			answer.IPs = append(answer.IPs, net.ParseIP(ip))
+		}
+		served = append(served, answer)
+	}
+
+	rendered := recordLines(served)
+	drift := lineDrift(recordLines(p.server.Records()), rendered)
+	p.server.SetRecords(served)
+	return Applied{Drift: drift, Rendered: rendered}, nil
+}
+
+// Start runs the DNS server, which the manager does on the leader only.
+func (p *embeddedProvider) Start(ctx context.Context) error {
+	return p.server.Start(ctx)
+}
+
+// NeedLeaderElection makes the manager run the DNS server on the leader only.
+func (p *embeddedProvider) NeedLeaderElection() bool {
+	return p.server.NeedLeaderElection()
+}
+
+// recordLines formats records one per line.
+func recordLines(records []dnsserver.Record) string {
+	var lines strings.Builder
+	for _, record := range records {
+		lines.WriteString(record.String() + "\n")
+	}
+	return lines.String()
+}
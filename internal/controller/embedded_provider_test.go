@@ -0,0 +1,65 @@
+package controller
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/miekg/dns"
+)
+
+func TestEmbeddedProvider(t *testing.T) {
+	const nginx = "nginx.ingress.svc.cluster.local"
+	c := newFakeClient(t, newService("ingress", "nginx", "10.96.0.10"))
+	r := &IngressReconciler{Client: c, Log: logr.Discard(), ClusterDomain: "cluster.local", DNSProvider: ProviderEmbedded}
+	provider, err := r.dnsProvider()
+	if err != nil {
+		t.Fatalf("dnsProvider() returned error: %v", err)
+	}
+	embedded := provider.(*embeddedProvider)
+
+	packetConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", packetConn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = embedded.server.Serve(ctx, packetConn, listener) }()
+
+	records := []rewriteRule{
+		{Host: "www.example.com", Target: nginx},
+		{Host: "*.apps.example.com", Target: nginx},
+	}
+	applied, err := provider.Apply(context.Background(), records)
+	if err != nil {
+		t.Fatalf("Apply() returned error: %v", err)
+	}
+	drift := applied.Drift
+	expected := []string{"www.example.com. 10.96.0.10", "*.apps.example.com. 10.96.0.10"}
+	if !reflect.DeepEqual(drift.Missing, expected) || len(drift.Stale) != 0 {
+		t.Errorf("unexpected drift: %+v", drift)
+	}
+
+	for _, name := range []string{"www.example.com.", "web.apps.example.com."} {
+		resp, err := dns.Exchange(new(dns.Msg).SetQuestion(name, dns.TypeA), packetConn.LocalAddr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(resp.Answer) != 1 || resp.Answer[0].(*dns.A).A.String() != "10.96.0.10" || !resp.Authoritative {
+			t.Errorf("unexpected answer for %s: %v", name, resp.Answer)
+		}
+	}
+
+	if applied, err = provider.Apply(context.Background(), records[:1]); err != nil {
+		t.Fatalf("Apply() returned error: %v", err)
+	}
+	if drift = applied.Drift; len(drift.Missing) != 0 || !reflect.DeepEqual(drift.Stale, expected[1:]) {
+		t.Errorf("unexpected drift: %+v", drift)
+	}
+}
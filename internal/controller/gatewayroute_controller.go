@@ -0,0 +1,325 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+
+	corev1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+)
+
+// gatewayNameLabel is set by Gateway API implementations on the Service
+// they provision for a Gateway (GEP-1762).
+const gatewayNameLabel = "gateway.networking.k8s.io/gateway-name"
+
+// Gateway API route kinds that can contribute hostnames to the rewrite rules.
+const (
+	HTTPRouteKind = "HTTPRoute"
+	GRPCRouteKind = "GRPCRoute"
+	TLSRouteKind  = "TLSRoute"
+)
+
+// gatewayRouteKinds maps each supported route kind to its API group version.
+var gatewayRouteKinds = map[string]schema.GroupVersion{
+	HTTPRouteKind: gatewayv1.SchemeGroupVersion,
+	GRPCRouteKind: gatewayv1.SchemeGroupVersion,
+	TLSRouteKind:  gatewayv1alpha2.SchemeGroupVersion,
+}
+
+// gatewayRoute holds the fields kic needs from any Gateway API route kind.
+type gatewayRoute struct {
+	object     client.Object
+	hostnames  []gatewayv1.Hostname
+	parentRefs []gatewayv1.ParentReference
+	parents    []gatewayv1.RouteParentStatus
+}
+
+// InstalledGatewayRouteKinds returns the supported route kinds whose CRDs are
+// served by the cluster. TLSRoute in particular only ships in the
+// experimental channel, so it cannot be assumed to exist.
+func InstalledGatewayRouteKinds(mapper meta.RESTMapper) ([]string, error) {
+	var kinds []string
+	for _, kind := range []string{HTTPRouteKind, GRPCRouteKind, TLSRouteKind} {
+		gv := gatewayRouteKinds[kind]
+		if _, err := mapper.RESTMapping(gv.WithKind(kind).GroupKind(), gv.Version); err != nil {
+			if meta.IsNoMatchError(err) {
+				continue
+			}
+			return nil, err
+		}
+		kinds = append(kinds, kind)
+	}
+	return kinds, nil
+}
+
+// GatewayRouteReconciler reconciles Gateway API routes and their parent
+// Gateways. Routes feed the same managed CoreDNS block as Ingresses, so every
+// event triggers a full rebuild through the IngressReconciler.
+type GatewayRouteReconciler struct {
+	Log     logr.Logger
+	Ingress *IngressReconciler
+}
+
+// +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=httproutes;grpcroutes;tlsroutes;gateways,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=services,verbs=get;list;watch
+
+// Reconcile rebuilds the managed CoreDNS rewrite rules whenever a route,
+// a Gateway or a Gateway's Service changes.
+func (r *GatewayRouteReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	r.Log.V(1).Info("Gateway API change detected, rebuilding rewrite rules")
+	return ctrl.Result{}, r.Ingress.updateDNS(ctx)
+}
+
+// listGatewayRoutes lists every route of the given kind.
+func (r *IngressReconciler) listGatewayRoutes(ctx context.Context, kind string) ([]gatewayRoute, error) {
+	var routes []gatewayRoute
+	switch kind {
+	case HTTPRouteKind:
+		var list gatewayv1.HTTPRouteList
+		if err := r.List(ctx, &list); err != nil {
+			return nil, err
+		}
+		for i := range list.Items {
+			route := &list.Items[i]
+			routes = append(routes, gatewayRoute{
+				object:     route,
+				hostnames:  route.Spec.Hostnames,
+				parentRefs: route.Spec.ParentRefs,
+				parents:    route.Status.Parents,
+			})
+		}
+	case GRPCRouteKind:
+		var list gatewayv1.GRPCRouteList
+		if err := r.List(ctx, &list); err != nil {
+			return nil, err
+		}
+		for i := range list.Items {
+			route := &list.Items[i]
+			routes = append(routes, gatewayRoute{
+				object:     route,
+				hostnames:  route.Spec.Hostnames,
+				parentRefs: route.Spec.ParentRefs,
+				parents:    route.Status.Parents,
+			})
+		}
+	case TLSRouteKind:
+		var list gatewayv1alpha2.TLSRouteList
+		if err := r.List(ctx, &list); err != nil {
+			return nil, err
+		}
+		for i := range list.Items {
+			route := &list.Items[i]
+			routes = append(routes, gatewayRoute{
+				object:     route,
+				hostnames:  route.Spec.Hostnames,
+				parentRefs: route.Spec.ParentRefs,
+				parents:    route.Status.Parents,
+			})
+		}
+	default:
+		return nil, fmt.Errorf("unsupported Gateway API route kind %q", kind)
+	}
+	return routes, nil
+}
+
+// gatewayRouteRewriteRules returns a rewrite rule for every hostname of every
+// route of the enabled kinds, targeting the Service of the first resolvable
+// parent Gateway that accepted the route.
+func (r *IngressReconciler) gatewayRouteRewriteRules(ctx context.Context) ([]rewriteRule, error) {
+	var rules []rewriteRule
+	for _, kind := range r.GatewayRouteKinds {
+		routes, err := r.listGatewayRoutes(ctx, kind)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, route := range routes {
+			if !r.hasRequiredAnnotation(route.object) || len(route.hostnames) == 0 {
+				continue
+			}
+
+			target, err := r.routeTarget(ctx, route)
+			if err != nil {
+				return nil, err
+			}
+			if target == "" {
+				r.Log.Info("No parent Gateway accepting the route with a service found, skipping",
+					"kind", kind, "route", client.ObjectKeyFromObject(route.object))
+				continue
+			}
+
+			for _, hostname := range route.hostnames {
+				rules = append(rules, rewriteRule{
+					Host:        string(hostname),
+					Target:      target,
+					SuffixMatch: true,
+					Source:      route.object,
+				})
+			}
+		}
+	}
+	return rules, nil
+}
+
+// routeTarget resolves the rewrite target of a route from its parent references.
+// Only Gateway parents that accepted the route are considered, so that a route
+// cannot claim hostnames through a Gateway that does not allow it, and the
+// first one with a known Service wins.
+func (r *IngressReconciler) routeTarget(ctx context.Context, route gatewayRoute) (string, error) {
+	namespace := route.object.GetNamespace()
+	for _, ref := range route.parentRefs {
+		if ref.Group != nil && *ref.Group != gatewayv1.GroupName {
+			continue
+		}
+		if ref.Kind != nil && *ref.Kind != "Gateway" {
+			continue
+		}
+		if !routeAccepted(namespace, ref, route.parents) {
+			continue
+		}
+
+		key := types.NamespacedName{Namespace: namespace, Name: string(ref.Name)}
+		if ref.Namespace != nil {
+			key.Namespace = string(*ref.Namespace)
+		}
+
+		target, err := r.gatewayTarget(ctx, key)
+		if err != nil {
+			return "", err
+		}
+		if target != "" {
+			return target, nil
+		}
+	}
+	return "", nil
+}
+
+// routeAccepted reports whether the status of a route, in the given
+// namespace, has the parent ref accepted by one of the Gateway's controllers.
+func routeAccepted(namespace string, ref gatewayv1.ParentReference, parents []gatewayv1.RouteParentStatus) bool {
+	for _, parent := range parents {
+		if sameParentRef(namespace, ref, parent.ParentRef) &&
+			meta.IsStatusConditionTrue(parent.Conditions, string(gatewayv1.RouteConditionAccepted)) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameParentRef reports whether two parent refs of a route, in the given
+// namespace, point at the same parent once their defaults are filled in.
+func sameParentRef(namespace string, a, b gatewayv1.ParentReference) bool {
+	normalize := func(ref gatewayv1.ParentReference) gatewayv1.ParentReference {
+		if ref.Group == nil {
+			group := gatewayv1.Group(gatewayv1.GroupName)
+			ref.Group = &group
+		}
+		if ref.Kind == nil {
+			kind := gatewayv1.Kind("Gateway")
+			ref.Kind = &kind
+		}
+		if ref.Namespace == nil {
+			ns := gatewayv1.Namespace(namespace)
+			ref.Namespace = &ns
+		}
+		return ref
+	}
+	a, b = normalize(a), normalize(b)
+	return *a.Group == *b.Group && *a.Kind == *b.Kind && *a.Namespace == *b.Namespace && a.Name == b.Name &&
+		ptr.Equal(a.SectionName, b.SectionName) && ptr.Equal(a.Port, b.Port)
+}
+
+// gatewayTarget returns the FQDN of the Service fronting a Gateway. The
+// targetAnnotation on the Gateway takes precedence over the Service the
+// implementation labelled with gatewayNameLabel.
+func (r *IngressReconciler) gatewayTarget(ctx context.Context, key types.NamespacedName) (string, error) {
+	var gateway gatewayv1.Gateway
+	if err := r.Get(ctx, key, &gateway); err != nil {
+		if errors.IsNotFound(err) {
+			return "", nil
+		}
+		return "", err
+	}
+
+	target, err := annotationTarget(&gateway)
+	if err != nil {
+		r.Log.Error(err, "Ignoring Gateway with invalid rewrite target", "gateway", key)
+		r.recordWarning(&gateway, reasonInvalidTarget, "Routes not rewritten: %v", err)
+		return "", nil
+	}
+	if target != "" {
+		return target, nil
+	}
+
+	var services corev1.ServiceList
+	if err := r.List(ctx, &services, client.InNamespace(key.Namespace), client.MatchingLabels{gatewayNameLabel: key.Name}); err != nil {
+		return "", err
+	}
+	if len(services.Items) == 0 {
+		return "", nil
+	}
+
+	// Pick a stable Service if the implementation created more than one.
+	sort.Slice(services.Items, func(i, j int) bool {
+		return services.Items[i].Name < services.Items[j].Name
+	})
+	return r.serviceFQDN(services.Items[0].Name, services.Items[0].Namespace), nil
+}
+
+// SetupWithManager sets up the controller with the Manager. Only the route
+// kinds listed in the IngressReconciler's GatewayRouteKinds are watched.
+func (r *GatewayRouteReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	hasGatewayLabel := predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		_, ok := obj.GetLabels()[gatewayNameLabel]
+		return ok
+	})
+
+	enqueue := enqueueDNSUpdate(r.Ingress.Debounce)
+	b := ctrl.NewControllerManagedBy(mgr).
+		Watches(&gatewayv1.Gateway{}, enqueue).
+		Watches(&corev1.Service{}, enqueue, builder.WithPredicates(hasGatewayLabel))
+
+	for _, kind := range r.Ingress.GatewayRouteKinds {
+		switch kind {
+		case HTTPRouteKind:
+			b = b.Watches(&gatewayv1.HTTPRoute{}, enqueue)
+		case GRPCRouteKind:
+			b = b.Watches(&gatewayv1.GRPCRoute{}, enqueue)
+		case TLSRouteKind:
+			b = b.Watches(&gatewayv1alpha2.TLSRoute{}, enqueue)
+		default:
+			return fmt.Errorf("unsupported Gateway API route kind %q", kind)
+		}
+	}
+
+	return b.Named("gatewayroute").Complete(r)
+}
@@ -0,0 +1,173 @@
+package controller
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+)
+
+func TestGatewayRouteRewriteRules(t *testing.T) {
+	otherNamespace := gatewayv1.Namespace("infra")
+	appsNamespace := gatewayv1.Namespace("apps")
+	objs := []client.Object{
+		&gatewayv1.Gateway{ObjectMeta: metav1.ObjectMeta{Name: "public", Namespace: "apps"}},
+		&corev1.Service{ObjectMeta: metav1.ObjectMeta{
+			Name: "public-istio", Namespace: "apps",
+			Labels: map[string]string{gatewayNameLabel: "public"},
+		}},
+		&gatewayv1.Gateway{ObjectMeta: metav1.ObjectMeta{
+			Name: "shared", Namespace: "infra",
+			Annotations: map[string]string{targetAnnotation: "envoy.envoy-gateway-system.svc.cluster.local"},
+		}},
+		&gatewayv1.HTTPRoute{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "apps"},
+			Spec: gatewayv1.HTTPRouteSpec{
+				CommonRouteSpec: gatewayv1.CommonRouteSpec{
+					ParentRefs: []gatewayv1.ParentReference{{Name: "missing"}, {Name: "public"}},
+				},
+				Hostnames: []gatewayv1.Hostname{"web.example.com", "www.example.com"},
+			},
+			Status: gatewayv1.HTTPRouteStatus{RouteStatus: acceptedBy(gatewayv1.ParentReference{Name: "public"})},
+		},
+		&gatewayv1.HTTPRoute{
+			ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "apps"},
+			Spec: gatewayv1.HTTPRouteSpec{
+				CommonRouteSpec: gatewayv1.CommonRouteSpec{
+					ParentRefs: []gatewayv1.ParentReference{{Name: "shared", Namespace: &otherNamespace}},
+				},
+				Hostnames: []gatewayv1.Hostname{"api.example.com"},
+			},
+			Status: gatewayv1.HTTPRouteStatus{
+				RouteStatus: acceptedBy(gatewayv1.ParentReference{Name: "shared", Namespace: &otherNamespace}),
+			},
+		},
+		&gatewayv1.GRPCRoute{
+			ObjectMeta: metav1.ObjectMeta{Name: "grpc", Namespace: "apps"},
+			Spec: gatewayv1.GRPCRouteSpec{
+				CommonRouteSpec: gatewayv1.CommonRouteSpec{
+					ParentRefs: []gatewayv1.ParentReference{{Name: "public"}},
+				},
+				Hostnames: []gatewayv1.Hostname{"grpc.example.com"},
+			},
+			Status: gatewayv1.GRPCRouteStatus{RouteStatus: acceptedBy(gatewayv1.ParentReference{Name: "public"})},
+		},
+		&gatewayv1alpha2.TLSRoute{
+			ObjectMeta: metav1.ObjectMeta{Name: "passthrough", Namespace: "apps"},
+			Spec: gatewayv1alpha2.TLSRouteSpec{
+				CommonRouteSpec: gatewayv1.CommonRouteSpec{
+					ParentRefs: []gatewayv1.ParentReference{{Name: "shared", Namespace: &otherNamespace}},
+				},
+				Hostnames: []gatewayv1.Hostname{"db.example.com"},
+			},
+			Status: gatewayv1alpha2.TLSRouteStatus{
+				RouteStatus: acceptedBy(gatewayv1.ParentReference{Name: "shared", Namespace: &otherNamespace}),
+			},
+		},
+		&gatewayv1.HTTPRoute{
+			ObjectMeta: metav1.ObjectMeta{Name: "orphan", Namespace: "apps"},
+			Spec: gatewayv1.HTTPRouteSpec{
+				CommonRouteSpec: gatewayv1.CommonRouteSpec{
+					ParentRefs: []gatewayv1.ParentReference{{Name: "missing"}},
+				},
+				Hostnames: []gatewayv1.Hostname{"orphan.example.com"},
+			},
+		},
+		// A route in another namespace pointing at a Gateway that does not
+		// allow it: the Gateway's controller never accepts it.
+		&gatewayv1.HTTPRoute{
+			ObjectMeta: metav1.ObjectMeta{Name: "hijack", Namespace: "tenant"},
+			Spec: gatewayv1.HTTPRouteSpec{
+				CommonRouteSpec: gatewayv1.CommonRouteSpec{
+					ParentRefs: []gatewayv1.ParentReference{{Name: "public", Namespace: &appsNamespace}},
+				},
+				Hostnames: []gatewayv1.Hostname{"web.example.com"},
+			},
+			Status: gatewayv1.HTTPRouteStatus{RouteStatus: gatewayv1.RouteStatus{
+				Parents: []gatewayv1.RouteParentStatus{{
+					ParentRef:      gatewayv1.ParentReference{Name: "public", Namespace: &appsNamespace},
+					ControllerName: "example.com/gateway-controller",
+					Conditions: []metav1.Condition{{
+						Type:   string(gatewayv1.RouteConditionAccepted),
+						Status: metav1.ConditionFalse,
+						Reason: string(gatewayv1.RouteReasonNotAllowedByListeners),
+					}},
+				}},
+			}},
+		},
+		// A route whose Gateway has not reported on it yet.
+		&gatewayv1.HTTPRoute{
+			ObjectMeta: metav1.ObjectMeta{Name: "pending", Namespace: "apps"},
+			Spec: gatewayv1.HTTPRouteSpec{
+				CommonRouteSpec: gatewayv1.CommonRouteSpec{
+					ParentRefs: []gatewayv1.ParentReference{{Name: "public"}},
+				},
+				Hostnames: []gatewayv1.Hostname{"pending.example.com"},
+			},
+		},
+	}
+
+	r := &IngressReconciler{
+		Client:            newFakeClient(t, objs...),
+		ClusterDomain:     "cluster.local",
+		GatewayRouteKinds: []string{HTTPRouteKind, GRPCRouteKind, TLSRouteKind},
+	}
+
+	rules, err := r.gatewayRouteRewriteRules(context.Background())
+	if err != nil {
+		t.Fatalf("gatewayRouteRewriteRules() returned error: %v", err)
+	}
+	rules = withoutSources(rules)
+
+	// Routes are grouped by kind; the fake client lists each kind ordered by namespace and name.
+	expected := []rewriteRule{
+		{Host: "api.example.com", Target: "envoy.envoy-gateway-system.svc.cluster.local", SuffixMatch: true},
+		{Host: "web.example.com", Target: "public-istio.apps.svc.cluster.local", SuffixMatch: true},
+		{Host: "www.example.com", Target: "public-istio.apps.svc.cluster.local", SuffixMatch: true},
+		{Host: "grpc.example.com", Target: "public-istio.apps.svc.cluster.local", SuffixMatch: true},
+		{Host: "db.example.com", Target: "envoy.envoy-gateway-system.svc.cluster.local", SuffixMatch: true},
+	}
+	if !reflect.DeepEqual(rules, expected) {
+		t.Errorf("gatewayRouteRewriteRules():\nExpected: %v\nActual:   %v", expected, rules)
+	}
+}
+
+// acceptedBy returns a route status in which the controller of each parent
+// accepted the route.
+func acceptedBy(refs ...gatewayv1.ParentReference) gatewayv1.RouteStatus {
+	var status gatewayv1.RouteStatus
+	for _, ref := range refs {
+		status.Parents = append(status.Parents, gatewayv1.RouteParentStatus{
+			ParentRef:      ref,
+			ControllerName: "example.com/gateway-controller",
+			Conditions: []metav1.Condition{{
+				Type:   string(gatewayv1.RouteConditionAccepted),
+				Status: metav1.ConditionTrue,
+				Reason: string(gatewayv1.RouteReasonAccepted),
+			}},
+		})
+	}
+	return status
+}
+
+func TestInstalledGatewayRouteKinds(t *testing.T) {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(gatewayv1.SchemeGroupVersion.WithKind(HTTPRouteKind), meta.RESTScopeNamespace)
+	mapper.Add(gatewayv1alpha2.SchemeGroupVersion.WithKind(TLSRouteKind), meta.RESTScopeNamespace)
+
+	kinds, err := InstalledGatewayRouteKinds(mapper)
+	if err != nil {
+		t.Fatalf("InstalledGatewayRouteKinds() returned error: %v", err)
+	}
+
+	expected := []string{HTTPRouteKind, TLSRouteKind}
+	if !reflect.DeepEqual(kinds, expected) {
+		t.Errorf("InstalledGatewayRouteKinds():\nExpected: %v\nActual:   %v", expected, kinds)
+	}
+}
@@ -0,0 +1,139 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+const (
+	// BackendRewrite rewrites Ingress hosts to the name of their target service.
+	BackendRewrite = "rewrite"
+	// BackendHosts answers Ingress hosts with the ClusterIPs of their target service.
+	BackendHosts = "hosts"
+
+	// hostsTTL is the TTL of the answers of the hosts plugin, which defaults to an hour.
+	hostsTTL = 30
+)
+
+// serviceForTarget returns the Service a target FQDN such as
+// "ingress-nginx-controller.ingress-nginx.svc.cluster.local" points to.
+func (r *IngressReconciler) serviceForTarget(target string) (client.ObjectKey, bool) {
+	name, ok := strings.CutSuffix(strings.TrimSuffix(target, "."), ".svc."+r.ClusterDomain)
+	if !ok {
+		return client.ObjectKey{}, false
+	}
+	name, namespace, ok := strings.Cut(name, ".")
+	if !ok || name == "" || namespace == "" || strings.Contains(namespace, ".") {
+		return client.ObjectKey{}, false
+	}
+	return client.ObjectKey{Namespace: namespace, Name: name}, true
+}
+
+// targetClusterIPs returns the ClusterIPs of the Service a target points to.
+// It returns none for targets outside the cluster, missing Services and
+// headless Services.
+func (r *IngressReconciler) targetClusterIPs(ctx context.Context, target string) ([]string, error) {
+	key, ok := r.serviceForTarget(target)
+	if !ok {
+		return nil, nil
+	}
+
+	var service corev1.Service
+	if err := r.Get(ctx, key, &service); err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return serviceClusterIPs(&service), nil
+}
+
+// ruleIPs returns the addresses a rule answers: its own IPs, or else the
+// ClusterIPs of its target.
+func (r *IngressReconciler) ruleIPs(ctx context.Context, rule rewriteRule) ([]string, error) {
+	if len(rule.IPs) > 0 {
+		return rule.IPs, nil
+	}
+	ips, err := r.targetClusterIPs(ctx, rule.Target)
+	if err != nil {
+		return nil, fmt.Errorf("unable to resolve target %q: %w", rule.Target, err)
+	}
+	return ips, nil
+}
+
+// serviceClusterIPs returns the ClusterIPs of a Service, of every IP family.
+func serviceClusterIPs(service *corev1.Service) []string {
+	ips := service.Spec.ClusterIPs
+	if len(ips) == 0 && service.Spec.ClusterIP != "" {
+		ips = []string{service.Spec.ClusterIP}
+	}
+	return slices.DeleteFunc(slices.Clone(ips), func(ip string) bool {
+		return ip == "" || ip == corev1.ClusterIPNone
+	})
+}
+
+// renderHostsRules renders the rules for the hosts backend: a hosts plugin
+// block answering every exact host with its IPs or the ClusterIPs of its
+// target service. Wildcard hosts, which the hosts plugin cannot match, and
+// hosts whose target does not resolve to a ClusterIP keep their rule.
+func (r *IngressReconciler) renderHostsRules(ctx context.Context, rules []rewriteRule) (string, error) {
+	var hosts, rewrites strings.Builder
+	for _, rule := range rules {
+		if rule.SuffixMatch || strings.HasPrefix(rule.Host, "*.") {
+			rewrites.WriteString(rule.String())
+			continue
+		}
+
+		ips, err := r.ruleIPs(ctx, rule)
+		if err != nil {
+			return "", err
+		}
+		if len(ips) == 0 {
+			r.Log.V(1).Info("Target has no ClusterIP, keeping the rewrite rule", "host", rule.Host, "target", rule.Target)
+			rewrites.WriteString(rule.String())
+			continue
+		}
+		for _, ip := range ips {
+			fmt.Fprintf(&hosts, "    %s %s\n", ip, rule.Host)
+		}
+	}
+
+	if hosts.Len() == 0 {
+		return rewrites.String(), nil
+	}
+	return fmt.Sprintf("hosts {\n%s    ttl %d\n    fallthrough\n}\n", hosts.String(), hostsTTL) + rewrites.String(), nil
+}
+
+// clusterIPsChanged lets Service updates through only when their ClusterIPs
+// change, which is all the hosts backend cares about.
+var clusterIPsChanged = predicate.Funcs{
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		oldService, okOld := e.ObjectOld.(*corev1.Service)
+		newService, okNew := e.ObjectNew.(*corev1.Service)
+		return okOld && okNew && !slices.Equal(serviceClusterIPs(oldService), serviceClusterIPs(newService))
+	},
+}
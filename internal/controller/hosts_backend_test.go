@@ -0,0 +1,111 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+func newService(namespace, name string, clusterIPs ...string) *corev1.Service {
+	service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}}
+	service.Spec.ClusterIPs = clusterIPs
+	if len(clusterIPs) > 0 {
+		service.Spec.ClusterIP = clusterIPs[0]
+	}
+	return service
+}
+
+func TestServiceForTarget(t *testing.T) {
+	r := &IngressReconciler{ClusterDomain: "cluster.local"}
+	tests := []struct {
+		target   string
+		expected client.ObjectKey
+		ok       bool
+	}{
+		{target: "nginx.ingress.svc.cluster.local", expected: client.ObjectKey{Namespace: "ingress", Name: "nginx"}, ok: true},
+		{target: "nginx.ingress.svc.cluster.local.", expected: client.ObjectKey{Namespace: "ingress", Name: "nginx"}, ok: true},
+		{target: "nginx.svc.cluster.local"},
+		{target: "a.b.c.svc.cluster.local"},
+		{target: "nginx.ingress.svc.other.local"},
+		{target: "gateway.example.com"},
+	}
+	for _, tt := range tests {
+		key, ok := r.serviceForTarget(tt.target)
+		if ok != tt.ok || key != tt.expected {
+			t.Errorf("serviceForTarget(%q) = %v, %v; expected %v, %v", tt.target, key, ok, tt.expected, tt.ok)
+		}
+	}
+}
+
+func TestRenderHostsRules(t *testing.T) {
+	const (
+		nginx    = "nginx.ingress.svc.cluster.local"
+		headless = "headless.ingress.svc.cluster.local"
+		missing  = "missing.ingress.svc.cluster.local"
+		external = "gateway.example.com"
+	)
+	c := newFakeClient(t,
+		newService("ingress", "nginx", "10.96.0.10", "fd00::10"),
+		newService("ingress", "headless", corev1.ClusterIPNone),
+	)
+	r := &IngressReconciler{Client: c, Log: logr.Discard(), ClusterDomain: "cluster.local"}
+
+	rules := []rewriteRule{
+		{Host: "api.example.com", Target: nginx},
+		{Host: "a.example.com", Target: headless},
+		{Host: "b.example.com", Target: missing},
+		{Host: "c.example.com", Target: external},
+		{Host: "www.example.com", Target: nginx},
+		{Host: "*.apps.example.com", Target: nginx},
+	}
+	actual, err := r.renderHostsRules(context.Background(), rules)
+	if err != nil {
+		t.Fatalf("renderHostsRules() returned error: %v", err)
+	}
+
+	expected := "hosts {\n" +
+		"    10.96.0.10 api.example.com\n" +
+		"    fd00::10 api.example.com\n" +
+		"    10.96.0.10 www.example.com\n" +
+		"    fd00::10 www.example.com\n" +
+		"    ttl 30\n" +
+		"    fallthrough\n" +
+		"}\n" +
+		"rewrite name a.example.com " + headless + "\n" +
+		"rewrite name b.example.com " + missing + "\n" +
+		"rewrite name c.example.com " + external + "\n" +
+		`rewrite name regex ^[^.]+\.apps\.example\.com\.$ ` + nginx + ". answer auto\n"
+	if actual != expected {
+		t.Errorf("renderHostsRules():\nExpected:\n%s\nActual:\n%s", expected, actual)
+	}
+
+	// The hosts block goes into the Corefile like any other managed rules, but
+	// never next to an existing hosts plugin.
+	corefile := ".:53 {\n    kubernetes cluster.local\n}\n"
+	if _, err := r.injectRewriteRules(corefile, actual); err != nil {
+		t.Errorf("injectRewriteRules() returned error: %v", err)
+	}
+	corefile = ".:53 {\n    hosts /etc/coredns/NodeHosts {\n        fallthrough\n    }\n    kubernetes cluster.local\n}\n"
+	if _, err := r.injectRewriteRules(corefile, actual); err == nil {
+		t.Errorf("injectRewriteRules() expected an error for a second hosts plugin")
+	}
+}
+
+func TestClusterIPsChanged(t *testing.T) {
+	old := newService("ingress", "nginx", "10.96.0.10")
+	relabelled := old.DeepCopy()
+	relabelled.Labels = map[string]string{"team": "platform"}
+	dualStack := newService("ingress", "nginx", "10.96.0.10", "fd00::10")
+
+	if clusterIPsChanged.Update(event.UpdateEvent{ObjectOld: old, ObjectNew: relabelled}) {
+		t.Errorf("expected label changes to be filtered out")
+	}
+	if !clusterIPsChanged.Update(event.UpdateEvent{ObjectOld: old, ObjectNew: dualStack}) {
+		t.Errorf("expected ClusterIP changes to pass")
+	}
+}
@@ -19,17 +19,27 @@ package controller
 import (
 	"context"
 	"fmt"
+	"net"
 	"regexp"
+	"slices"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/go-logr/logr"
-	"k8s.io/apimachinery/pkg/api/errors"
+	"github.com/pelotech/kic/internal/corefile"
 
 	corev1 "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 )
 
 const (
@@ -39,6 +49,18 @@ const (
 	rewriteRuleFormat         = "rewrite name %s %s\n"
 	managedRulesBeginMarker   = "# BEGIN IngressReconciler managed rules"
 	managedRulesEndMarker     = "# END IngressReconciler managed rules"
+	// rewriteRegexRuleFormat is used for wildcard hosts. `answer auto` rewrites the
+	// answer section back to the queried name, which exact rules do implicitly.
+	rewriteRegexRuleFormat = "rewrite name regex %s %s answer auto\n"
+	// legacyIngressClassAnnotation predates spec.ingressClassName but is still honoured by most controllers.
+	legacyIngressClassAnnotation = "kubernetes.io/ingress.class"
+	// targetAnnotation overrides the rewrite target of the Ingress or Gateway it is set on.
+	targetAnnotation = "kic.pelo.tech/target"
+
+	// reasonInvalidTarget is the event reason used when a target annotation cannot be used.
+	reasonInvalidTarget = "InvalidTarget"
+	// reasonHostRejected is the event reason used when a host is not written into the Corefile.
+	reasonHostRejected = "HostRejected"
 )
 
 // IngressReconciler reconciles a Ingress object
@@ -46,60 +68,427 @@ type IngressReconciler struct {
 	client.Client
 	Log                          logr.Logger
 	Scheme                       *runtime.Scheme
+	Recorder                     record.EventRecorder
 	IngressAnnotation            string
 	IngressControllerServiceName string
-	CoreDNSExcludedNamespaces    []string
+	// IngressClassServiceNames maps an ingress class to the FQDN of its controller service.
+	// Ingresses of a class that is not listed fall back to IngressControllerServiceName.
+	IngressClassServiceNames  map[string]string
+	CoreDNSExcludedNamespaces []string
+	// ClusterDomain is the DNS domain of the cluster, used to build service FQDNs.
+	ClusterDomain string
+	// GatewayRouteKinds lists the Gateway API route kinds used as a source of rewrite rules.
+	GatewayRouteKinds []string
+	// ProtectedDomains are never rewritten, neither themselves nor any name below them.
+	ProtectedDomains []string
+	// CoreDNSServerBlocks lists the server blocks, as zone:port keys, that receive the
+	// managed rules. When empty, the server block with the kubernetes plugin is used.
+	CoreDNSServerBlocks []string
+	// ManagedConfigMapName, when set, is a ConfigMap owned by kic that holds the managed
+	// rules. The Corefile then only imports them from CoreDNSImportPath.
+	ManagedConfigMapName string
+	// CoreDNSImportPath is where CoreDNS finds the managed ConfigMap's files.
+	CoreDNSImportPath string
+	// Backend selects how hosts are resolved: BackendRewrite (the default), BackendHosts
+	// or BackendFile.
+	Backend string
+	// Zone is the domain served authoritatively by the file backend.
+	Zone string
+	// DNSProvider selects the DNS server the rules are applied to, ProviderCoreDNS by default.
+	DNSProvider string
+	// KubeDNSRollout makes the kube-dns provider roll out the kube-dns Deployment
+	// whenever the dnsmasq configuration changes, which dnsmasq only reads on start.
+	KubeDNSRollout bool
+	// EmbeddedDNSAddress is where the DNS server of the embedded provider listens.
+	EmbeddedDNSAddress string
+	// EmbeddedDNSUpstream, if set, answers the names the embedded provider has no record for.
+	EmbeddedDNSUpstream string
+	// RFC2136Server is the address of the DNS server the rfc2136 provider updates.
+	RFC2136Server string
+	// RFC2136Zone is the zone the rfc2136 provider updates.
+	RFC2136Zone string
+	// RFC2136TSIGSecret, as namespace/name, holds the TSIG key signing the updates.
+	RFC2136TSIGSecret string
+	// APIReader reads objects that are not cached, such as Secrets and the kube-dns
+	// Deployment. The client is used when nil.
+	APIReader client.Reader
+	// TargetSource selects where Ingress targets come from: TargetSourceConfig (the
+	// default), TargetSourceStatus or TargetSourceService.
+	TargetSource string
+	// ServerSideApply writes the ConfigMaps with server-side apply, owning only
+	// the keys kic writes, instead of updating them whole.
+	ServerSideApply bool
+	// Debounce is how long changes are collected before the DNS records are
+	// rebuilt, so that a burst of them causes a single write.
+	Debounce time.Duration
+	// NodeLocalDNS makes NodeLocal DNSCache, when deployed, forward the zones of
+	// the rules to cluster DNS.
+	NodeLocalDNS bool
+
+	// mu serializes updateDNS, which the Ingress and Gateway route controllers share.
+	mu sync.Mutex
+	// provider is the DNSProvider built from DNSProvider on first use.
+	provider DNSProvider
+	// warnings are the Warning events of the rebuild in progress, and
+	// reportedWarnings those of the previous one, which are not emitted again.
+	warnings, reportedWarnings map[warning]bool
+	// lastRendered is the configuration the provider last rendered the records
+	// into, to tell drift caused by someone else from changes of the sources.
+	lastRendered *string
+}
+
+// rewriteRule maps a single hostname onto the in-cluster service it should resolve to.
+type rewriteRule struct {
+	Host   string
+	Target string
+	// IPs, when set, answer the host directly instead of Target.
+	IPs []string
+	// SuffixMatch lets a wildcard host match any number of leading labels, as
+	// Gateway API hostnames do. Ingress wildcards only match a single label.
+	SuffixMatch bool
+	// Source is the object the rule was generated from.
+	Source client.Object
+}
+
+// validate checks that the rule can be safely interpolated into the Corefile.
+// Hosts must be RFC 1123 subdomains, optionally prefixed with a wildcard label,
+// targets must be RFC 1123 subdomains and IPs must be IP addresses.
+func (rule rewriteRule) validate() error {
+	var errs []string
+	if strings.HasPrefix(rule.Host, "*.") {
+		errs = validation.IsWildcardDNS1123Subdomain(rule.Host)
+	} else {
+		errs = validation.IsDNS1123Subdomain(rule.Host)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid host %q: %s", rule.Host, strings.Join(errs, "; "))
+	}
+	if len(rule.IPs) > 0 {
+		for _, ip := range rule.IPs {
+			if net.ParseIP(ip) == nil {
+				return fmt.Errorf("invalid IP %q for host %q", ip, rule.Host)
+			}
+		}
+		return nil
+	}
+	if errs := validation.IsDNS1123Subdomain(strings.TrimSuffix(rule.Target, ".")); len(errs) > 0 {
+		return fmt.Errorf("invalid target %q for host %q: %s", rule.Target, rule.Host, strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// destination describes what the host resolves to, for logs and events.
+func (rule rewriteRule) destination() string {
+	if len(rule.IPs) > 0 {
+		return strings.Join(rule.IPs, ", ")
+	}
+	return rule.Target
+}
+
+// String renders the rule as a CoreDNS rewrite directive. Wildcard hosts are
+// translated into anchored regex rules because `rewrite name` only matches
+// exact names. Rules answering IPs are rendered as template plugin blocks.
+func (rule rewriteRule) String() string {
+	if len(rule.IPs) > 0 {
+		return rule.templates()
+	}
+	if !strings.HasPrefix(rule.Host, "*.") {
+		return fmt.Sprintf(rewriteRuleFormat, rule.Host, rule.Target)
+	}
+	// The replacement is used verbatim as the new query name, so it must be fully qualified.
+	target := strings.TrimSuffix(rule.Target, ".") + "."
+	return fmt.Sprintf(rewriteRegexRuleFormat, rule.pattern(), target)
+}
+
+// pattern returns an anchored regex matching the fully qualified names the
+// host stands for.
+func (rule rewriteRule) pattern() string {
+	suffix, isWildcard := strings.CutPrefix(rule.Host, "*.")
+	if !isWildcard {
+		return "^" + regexp.QuoteMeta(strings.TrimSuffix(rule.Host, ".")) + `\.$`
+	}
+	labels := `[^.]+`
+	if rule.SuffixMatch {
+		labels = `.+`
+	}
+	return "^" + labels + `\.` + regexp.QuoteMeta(strings.TrimSuffix(suffix, ".")) + `\.$`
+}
+
+// templates renders a template plugin block per address family answering the
+// host with the rule's IPs. A family without IPs gets an empty answer, so the
+// query does not reach another resolver.
+func (rule rewriteRule) templates() string {
+	var b strings.Builder
+	for _, family := range []struct {
+		qtype string
+		ipv4  bool
+	}{{"A", true}, {"AAAA", false}} {
+		fmt.Fprintf(&b, "template IN %s {\n    match %s\n", family.qtype, rule.pattern())
+		for _, ip := range rule.IPs {
+			if (net.ParseIP(ip).To4() != nil) == family.ipv4 {
+				fmt.Fprintf(&b, "    answer \"{{ .Name }} %d IN %s %s\"\n", hostsTTL, family.qtype, ip)
+			}
+		}
+		b.WriteString("    fallthrough\n}\n")
+	}
+	return b.String()
+}
+
+// allowedRewriteRules drops every rule that fails validation or would rewrite
+// a protected domain, logging the reason and recording a HostRejected event on
+// the object the rule came from.
+func (r *IngressReconciler) allowedRewriteRules(rules []rewriteRule) []rewriteRule {
+	allowed := make([]rewriteRule, 0, len(rules))
+	rejected := map[string]int{}
+	for _, rule := range rules {
+		reason, err := r.rejectRewriteRule(rule)
+		if err != nil {
+			rejected[reason]++
+			r.Log.Error(err, "Rejecting rewrite rule", "source", sourceKey(rule.Source))
+			if rule.Source != nil {
+				r.recordWarning(rule.Source, reasonHostRejected, "Host not rewritten: %v", err)
+			}
+			continue
+		}
+		allowed = append(allowed, rule)
+	}
+
+	for _, reason := range []string{rejectReasonInvalid, rejectReasonProtected} {
+		rejectedHosts.WithLabelValues(reason).Set(float64(rejected[reason]))
+	}
+	return allowed
+}
+
+// rejectRewriteRule returns the reason and error for a rule that must not be
+// written into the Corefile, or a nil error if the rule is allowed.
+func (r *IngressReconciler) rejectRewriteRule(rule rewriteRule) (string, error) {
+	if err := rule.validate(); err != nil {
+		return rejectReasonInvalid, err
+	}
+	for _, domain := range r.ProtectedDomains {
+		if rule.overlaps(domain) {
+			return rejectReasonProtected, fmt.Errorf("host %q overlaps protected domain %q", rule.Host, domain)
+		}
+	}
+	return "", nil
+}
+
+// sourceKey returns a printable reference to the object a rule came from.
+func sourceKey(obj client.Object) string {
+	if obj == nil {
+		return ""
+	}
+	return client.ObjectKeyFromObject(obj).String()
+}
+
+// overlaps reports whether the rule could rewrite domain or any name below it.
+// A wildcard above the domain overlaps it when it can match the domain itself
+// or, for suffix matches, anything in between.
+func (rule rewriteRule) overlaps(domain string) bool {
+	domain = strings.ToLower(strings.Trim(domain, "."))
+	name, isWildcard := strings.CutPrefix(strings.ToLower(strings.TrimSuffix(rule.Host, ".")), "*.")
+	if name == domain || strings.HasSuffix(name, "."+domain) {
+		return true
+	}
+	if !isWildcard {
+		return false
+	}
+	labels, ok := strings.CutSuffix(domain, "."+name)
+	return ok && (rule.SuffixMatch || !strings.Contains(labels, "."))
+}
+
+// sortRewriteRules puts rules into canonical order so the managed block does
+// not change with the order objects are listed in. CoreDNS stops at the first
+// matching rewrite rule, so exact hosts come first, followed by wildcards from
+// the most to the least specific.
+func sortRewriteRules(rules []rewriteRule) {
+	sort.SliceStable(rules, func(i, j int) bool {
+		a, b := rules[i], rules[j]
+		aWildcard, bWildcard := strings.HasPrefix(a.Host, "*."), strings.HasPrefix(b.Host, "*.")
+		if aWildcard != bWildcard {
+			return !aWildcard
+		}
+		if aWildcard {
+			if la, lb := strings.Count(a.Host, "."), strings.Count(b.Host, "."); la != lb {
+				return la > lb
+			}
+			if a.SuffixMatch != b.SuffixMatch {
+				return !a.SuffixMatch
+			}
+		}
+		return a.Host < b.Host
+	})
+}
+
+// renderRewriteRules renders rules as CoreDNS rewrite directives, one per line.
+func renderRewriteRules(rules []rewriteRule) string {
+	var b strings.Builder
+	for _, rule := range rules {
+		b.WriteString(rule.String())
+	}
+	return b.String()
 }
 
 // +kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses/finalizers,verbs=update
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update;patch
+
+// The kube-dns provider's rollout needs get and patch on the kube-dns
+// Deployment. It is granted by config/kube-dns-rollout, which is opt-in,
+// rather than by a marker, since config/default would move the Role out of
+// kube-system.
 
-// Reconcile is part of the main kubernetes reconciliation loop which aims to
-// move the current state of the cluster closer to the desired state.
-// TODO(user): Modify the Reconcile function to compare the state specified by
-// the Ingress object against the actual cluster state, and then
-// perform operations to make the cluster state reflect the state specified by
-// the user.
-//
-// For more details, check Reconcile and its Result here:
-// - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.20.2/pkg/reconcile
+// Reconcile rebuilds the DNS records from every source. Every event is
+// mapped onto the single dnsUpdateRequest, so req carries no information.
 func (r *IngressReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
-	log := r.Log.WithValues("ingress", req.NamespacedName)
-
-	var ingress networkingv1.Ingress
-	if err := r.Get(ctx, req.NamespacedName, &ingress); err != nil {
-		if errors.IsNotFound(err) {
-			log.Info("Ingress resource not found. Ignoring since object must be deleted.")
-			// Trigger a reconciliation of all ingresses to remove stale rules
-			return ctrl.Result{}, r.updateCoreDNSConfigMap(ctx)
-		}
-		log.Error(err, "unable to fetch Ingress")
-		return ctrl.Result{}, err
+	r.Log.V(1).Info("Rebuilding DNS records")
+	return ctrl.Result{}, r.updateDNS(ctx)
+}
+
+// hasRequiredAnnotation reports whether obj passes the IngressAnnotation filter.
+func (r *IngressReconciler) hasRequiredAnnotation(obj client.Object) bool {
+	if r.IngressAnnotation == "" {
+		return true
 	}
+	_, ok := obj.GetAnnotations()[r.IngressAnnotation]
+	return ok
+}
 
-	// Filter based on annotation
-	if r.IngressAnnotation != "" {
-		annotations := ingress.GetAnnotations()
-		if _, ok := annotations[r.IngressAnnotation]; !ok {
-			log.Info("Ingress does not have the required annotation, skipping", "annotation", r.IngressAnnotation)
-			// Ensure no stale rules exist for this ingress if the annotation was removed
-			return ctrl.Result{}, r.updateCoreDNSConfigMap(ctx)
-		}
+// apiReader returns the APIReader, or the client when there is none.
+func (r *IngressReconciler) apiReader() client.Reader {
+	if r.APIReader != nil {
+		return r.APIReader
+	}
+	return r.Client
+}
+
+// serviceFQDN returns the cluster-internal DNS name of a Service.
+func (r *IngressReconciler) serviceFQDN(name, namespace string) string {
+	return fmt.Sprintf("%s.%s.svc.%s", name, namespace, r.ClusterDomain)
+}
+
+// ingressClass returns the class of an Ingress, preferring spec.ingressClassName
+// over the legacy annotation. It is empty for Ingresses without a class.
+func ingressClass(ingress *networkingv1.Ingress) string {
+	if ingress.Spec.IngressClassName != nil {
+		return *ingress.Spec.IngressClassName
+	}
+	return ingress.GetAnnotations()[legacyIngressClassAnnotation]
+}
+
+// recordEvent emits an event on obj when an EventRecorder is configured.
+func (r *IngressReconciler) recordEvent(obj runtime.Object, eventtype, reason, messageFmt string, args ...interface{}) {
+	if r.Recorder != nil {
+		r.Recorder.Eventf(obj, eventtype, reason, messageFmt, args...)
+	}
+}
+
+// warning identifies a Warning event recorded while rebuilding the rules.
+type warning struct {
+	object  string
+	reason  string
+	message string
+}
+
+// recordWarning emits a Warning event on obj, unless the previous rebuild of
+// the rules already emitted the same one: a rebuild is triggered by changes
+// to any object, and a persistent problem would otherwise be reported over
+// and over.
+func (r *IngressReconciler) recordWarning(obj client.Object, reason, messageFmt string, args ...interface{}) {
+	w := warning{
+		object:  fmt.Sprintf("%T %s", obj, sourceKey(obj)),
+		reason:  reason,
+		message: fmt.Sprintf(messageFmt, args...),
+	}
+	if r.warnings == nil {
+		r.warnings = map[warning]bool{}
+	}
+	r.warnings[w] = true
+	if !r.reportedWarnings[w] {
+		r.recordEvent(obj, corev1.EventTypeWarning, reason, "%s", w.message)
+	}
+}
+
+// rotateWarnings makes the warnings of the current rebuild the ones already
+// reported, so that a warning that went away is reported again if it comes back.
+func (r *IngressReconciler) rotateWarnings() {
+	r.reportedWarnings, r.warnings = r.warnings, nil
+}
+
+// annotationTarget returns the value of the targetAnnotation on obj, if any.
+// The target is written into the Corefile, so it must be a valid DNS subdomain.
+func annotationTarget(obj client.Object) (string, error) {
+	target, ok := obj.GetAnnotations()[targetAnnotation]
+	if !ok {
+		return "", nil
 	}
+	if errs := validation.IsDNS1123Subdomain(target); len(errs) > 0 {
+		return "", fmt.Errorf("invalid %s annotation %q: %s", targetAnnotation, target, strings.Join(errs, "; "))
+	}
+	return target, nil
+}
 
-	return ctrl.Result{}, r.updateCoreDNSConfigMap(ctx)
+// ingressTarget returns the service, or the IPs, that hosts of the given Ingress
+// are rewritten to. The targetAnnotation wins over the Ingress's load balancer
+// status when TargetSource uses it, which wins over the class mapping, which
+// wins over IngressControllerServiceName.
+func (r *IngressReconciler) ingressTarget(ingress *networkingv1.Ingress, lbServices map[string]string) (string, []string, error) {
+	target, err := annotationTarget(ingress)
+	if err != nil || target != "" {
+		return target, nil, err
+	}
+	if target, ips := r.statusTarget(ingress, lbServices); target != "" || len(ips) > 0 {
+		return target, ips, nil
+	}
+	if target, ok := r.IngressClassServiceNames[ingressClass(ingress)]; ok {
+		return target, nil, nil
+	}
+	return r.IngressControllerServiceName, nil, nil
 }
 
-func (r *IngressReconciler) updateCoreDNSConfigMap(ctx context.Context) error {
-	log := r.Log.WithName("coredns-updater")
+// ingressRewriteRules returns a rewrite rule for every host of every Ingress
+// passing the annotation filter. lbServices maps load balancer addresses to the
+// Service holding them, for TargetSourceService.
+func (r *IngressReconciler) ingressRewriteRules(ingresses []networkingv1.Ingress, lbServices map[string]string) []rewriteRule {
+	var rules []rewriteRule
+	for i := range ingresses {
+		ingress := &ingresses[i]
+		// Apply the same annotation filter as in the main reconcile loop
+		if !r.hasRequiredAnnotation(ingress) {
+			continue
+		}
 
-	// Get the CoreDNS configmap
-	var coreDNSConfigMap corev1.ConfigMap
-	if err := r.Get(ctx, client.ObjectKey{Namespace: coreDNSConfigMapNamespace, Name: coreDNSConfigMapName}, &coreDNSConfigMap); err != nil {
-		log.Error(err, "unable to fetch CoreDNS ConfigMap")
+		target, ips, err := r.ingressTarget(ingress, lbServices)
+		if err != nil {
+			r.Log.Error(err, "Ignoring Ingress with invalid rewrite target", "ingress", client.ObjectKeyFromObject(ingress))
+			r.recordWarning(ingress, reasonInvalidTarget, "Hosts not rewritten: %v", err)
+			continue
+		}
+		for _, rule := range ingress.Spec.Rules {
+			if rule.Host != "" {
+				rules = append(rules, rewriteRule{Host: rule.Host, Target: target, IPs: ips, Source: ingress})
+			}
+		}
+	}
+	return rules
+}
+
+// updateDNS collects the rewrite rules of every source and hands them to the
+// DNS provider, then reports the rewritten and skipped hosts and the host
+// conflicts on the Ingresses involved.
+func (r *IngressReconciler) updateDNS(ctx context.Context) error {
+	log := r.Log.WithName("dns-updater")
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	provider, err := r.dnsProvider()
+	if err != nil {
 		return err
 	}
+	// Forget the warnings of a rebuild that failed halfway
+	r.warnings = nil
 
 	// Get all ingresses in watched namespaces
 	var allIngresses networkingv1.IngressList
@@ -108,173 +497,377 @@ func (r *IngressReconciler) updateCoreDNSConfigMap(ctx context.Context) error {
 		return err
 	}
 
-	// Generate rewrite rules
-	var newRewriteRules strings.Builder
-	for _, ingress := range allIngresses.Items {
-		// Apply the same annotation filter as in the main reconcile loop
-		if r.IngressAnnotation != "" {
-			annotations := ingress.GetAnnotations()
-			if _, ok := annotations[r.IngressAnnotation]; !ok {
-				continue
-			}
+	lbServices, err := r.loadBalancerServices(ctx)
+	if err != nil {
+		log.Error(err, "unable to list load balancer Services")
+		return err
+	}
+
+	// Collect rewrite rules from every source
+	rules := r.ingressRewriteRules(allIngresses.Items, lbServices)
+	if len(r.GatewayRouteKinds) > 0 {
+		routeRules, err := r.gatewayRouteRewriteRules(ctx)
+		if err != nil {
+			log.Error(err, "unable to collect Gateway API route rewrite rules")
+			return err
 		}
+		rules = append(rules, routeRules...)
+	}
 
-		for _, rule := range ingress.Spec.Rules {
-			if rule.Host != "" {
-				newRewriteRules.WriteString(fmt.Sprintf(rewriteRuleFormat, rule.Host, r.IngressControllerServiceName))
-			}
+	// Never let a malformed or protected host reach the DNS server
+	rules = r.allowedRewriteRules(rules)
+	// Keep a single rule per host, in canonical order
+	rules, conflicts := r.resolveConflicts(rules)
+	sortRewriteRules(rules)
+	r.rotateWarnings()
+
+	applied, err := provider.Apply(ctx, rules)
+	if err != nil {
+		return err
+	}
+	if drift := applied.Drift; !drift.Empty() {
+		log.V(1).Info("DNS configuration drifted from the desired records", "missing", drift.Missing, "stale", drift.Stale)
+	}
+	r.recordDrift(applied)
+	// Only the rules the provider wrote are reported, and forwarded by NodeLocal DNSCache
+	appliedRules := applied.appliedRules(rules)
+	if r.forwardsNodeLocalDNS() {
+		if err := r.updateNodeLocalDNS(ctx, appliedRules); err != nil {
+			return err
 		}
 	}
 
-	// Update the Corefile
-	originalCorefile := coreDNSConfigMap.Data[corefileKey]
+	return r.syncIngressConditions(ctx, allIngresses.Items, appliedRules, applied.Skipped, conflicts)
+}
+
+// corefilesEquivalent reports whether two Corefiles only differ in
+// indentation, trailing whitespace or blank lines, none of which change how
+// CoreDNS interprets them. Rewriting the ConfigMap for such differences would
+// only cause a needless CoreDNS reload.
+func corefilesEquivalent(a, b string) bool {
+	return slices.Equal(significantLines(a), significantLines(b))
+}
 
-	rulesString := newRewriteRules.String()
-	// If there are excluded namespaces, wrap the rules in an expression
-	if len(r.CoreDNSExcludedNamespaces) > 0 && rulesString != "" {
-		// Format each namespace as a quoted string
-		quotedNamespaces := make([]string, len(r.CoreDNSExcludedNamespaces))
-		for i, ns := range r.CoreDNSExcludedNamespaces {
-			quotedNamespaces[i] = fmt.Sprintf("'%s'", ns)
+// significantLines returns the trimmed, non-blank lines of a Corefile.
+func significantLines(corefile string) []string {
+	var lines []string
+	for _, line := range strings.Split(corefile, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
 		}
-		// Create the CEL expression
-		expression := fmt.Sprintf("!(label('kubernetes/client-namespace') in [%s])", strings.Join(quotedNamespaces, ", "))
-		// Wrap the rules in the expression block
-		rulesString = fmt.Sprintf("expression \"%s\" {\n%s}\n", expression, strings.TrimSpace(rulesString))
 	}
+	return lines
+}
 
-	updatedCorefile := r.injectRewriteRules(originalCorefile, rulesString)
+// injectRewriteRules takes the current Corefile content and a string of new rewrite rules,
+// and returns the modified Corefile content. Both are parsed with the corefile package and
+// the rules are placed in a demarcated block. When CoreDNSServerBlocks is set, every listed
+// server block gets its own managed block. Otherwise an existing managed block is replaced
+// in place, or the block goes right after the kubernetes plugin of the first server block
+// that has one. Everything outside the managed blocks is printed back unchanged.
+func (r *IngressReconciler) injectRewriteRules(corefileContent string, newRules string) (string, error) {
+	parsed, err := corefile.Parse(corefileContent)
+	if err != nil {
+		return "", fmt.Errorf("unable to parse Corefile: %w", err)
+	}
 
-	// Only update if the content has changed
-	if originalCorefile == updatedCorefile {
-		log.Info("CoreDNS rewrite rules are already up to date.")
-		return nil
+	if len(r.CoreDNSServerBlocks) > 0 {
+		err = r.injectIntoServerBlocks(parsed, newRules)
+	} else {
+		err = injectIntoDefaultBlock(parsed, newRules)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	// CoreDNS refuses plugins used twice in a server block, which a managed
+	// hosts block does next to an existing one.
+	for _, block := range parsed.ServerBlocks() {
+		if countPlugin(block.Block, "hosts") > 1 {
+			return "", fmt.Errorf("server block %q already uses the hosts plugin", strings.Join(block.Keys(), " "))
+		}
+	}
+	return printCorefile(parsed), nil
+}
+
+// countPlugin returns how many of the given nodes use the named plugin.
+func countPlugin(nodes []*corefile.Node, name string) int {
+	count := 0
+	for _, node := range nodes {
+		if node.Name == name {
+			count++
+		}
+	}
+	return count
+}
+
+// printCorefile prints a parsed Corefile, trimming leading and trailing blank lines.
+func printCorefile(parsed *corefile.Corefile) string {
+	finalOutput := strings.TrimSpace(parsed.String())
+	if finalOutput != "" {
+		return finalOutput + "\n"
+	}
+	return ""
+}
+
+// newManagedBlock parses the rules and wraps them between the managed block
+// markers. The markers and the rules are printed at the start of the line,
+// as they always have been, whatever the indentation of the server block. It
+// also reports whether the rules need the metadata plugin.
+func newManagedBlock(newRules string) ([]*corefile.Node, bool, error) {
+	rules, err := corefile.Parse(newRules)
+	if err != nil {
+		return nil, false, fmt.Errorf("unable to parse rewrite rules: %w", err)
 	}
 
-	coreDNSConfigMap.Data[corefileKey] = updatedCorefile
+	managedBlock := []*corefile.Node{corefile.NewComment(managedRulesBeginMarker)}
+	needsMetadata := false
+	for _, node := range rules.Nodes {
+		if node.IsBlank() {
+			continue
+		}
+		managedBlock = append(managedBlock, node)
+		needsMetadata = needsMetadata || node.Name == "expression"
+	}
+	managedBlock = append(managedBlock, corefile.NewComment(managedRulesEndMarker))
+	for _, node := range managedBlock {
+		node.Pin("")
+	}
+	return managedBlock, needsMetadata, nil
+}
+
+// injectIntoDefaultBlock replaces the first managed block of the Corefile, or
+// inserts one after the kubernetes plugin of the first server block that has
+// one, falling back to the end of the first server block and then to the end
+// of the Corefile.
+func injectIntoDefaultBlock(parsed *corefile.Corefile, newRules string) error {
+	managedBlock, needsMetadata, err := newManagedBlock(newRules)
+	if err != nil {
+		return err
+	}
 
-	if err := r.Update(ctx, &coreDNSConfigMap); err != nil {
-		log.Error(err, "unable to update CoreDNS ConfigMap")
+	// block is the server block holding the managed block, nil when it is at the top level.
+	block, found, err := replaceManagedBlock(parsed, managedBlock)
+	if err != nil {
 		return err
 	}
+	if !found {
+		if block = defaultServerBlock(parsed); block != nil {
+			insertManagedBlock(block, managedBlock)
+		} else {
+			parsed.Nodes = append(parsed.Nodes, managedBlock...)
+		}
+	}
 
-	log.Info("Successfully updated CoreDNS ConfigMap with new rewrite rules")
+	// Ensure the 'metadata' plugin is present in the same server block if needed.
+	if needsMetadata {
+		ensureMetadata(parsed, block)
+	}
 	return nil
 }
 
-// injectRewriteRules takes the current Corefile content and a string of new rewrite rules,
-// and returns the modified Corefile content. It uses a regex-based approach to manage a
-// demarcated block of rules.
-func (r *IngressReconciler) injectRewriteRules(corefileContent string, newRules string) string {
-	// 1. Prepare the new managed block that should be in the Corefile.
-	var newManagedBlock strings.Builder
-	newManagedBlock.WriteString(managedRulesBeginMarker + "\n")
-	if newRules != "" {
-		newManagedBlock.WriteString(strings.TrimSpace(newRules) + "\n")
-	}
-	newManagedBlock.WriteString(managedRulesEndMarker)
-	blockToAdd := newManagedBlock.String()
-
-	// 2. Define a regex to find an existing managed block.
-	// The `(?s)` flag allows `.` to match newlines.
-	re := regexp.MustCompile(`(?s)` + regexp.QuoteMeta(managedRulesBeginMarker) + `.*` + regexp.QuoteMeta(managedRulesEndMarker) + `\n?`)
-
-	var updatedCorefile string
-	if re.MatchString(corefileContent) {
-		// Case 1: An existing block is found. Replace it with the new one.
-		updatedCorefile = re.ReplaceAllString(corefileContent, blockToAdd+"\n")
-	} else {
-		// Case 2: No existing block found. We need to inject it.
-		// We'll try to inject it right after the 'kubernetes' plugin for neatness.
-		lines := strings.Split(corefileContent, "\n")
-		insertionPoint := -1
-		braceCount := 0
-		inKubernetesBlock := false
-
-		for i, line := range lines {
-			if !inKubernetesBlock && strings.Contains(line, "kubernetes") {
-				inKubernetesBlock = true
-			}
+// defaultServerBlock returns the first server block with the kubernetes
+// plugin, or else the first server block. It returns nil for a Corefile
+// without server blocks.
+func defaultServerBlock(parsed *corefile.Corefile) *corefile.Node {
+	blocks := parsed.ServerBlocks()
+	for _, block := range blocks {
+		if kubernetes, _ := block.Directive("kubernetes"); kubernetes != nil {
+			return block
+		}
+	}
+	if len(blocks) > 0 {
+		return blocks[0]
+	}
+	return nil
+}
 
-			if inKubernetesBlock {
-				braceCount += strings.Count(line, "{")
-				braceCount -= strings.Count(line, "}")
-				if braceCount <= 0 {
-					insertionPoint = i + 1
-					break
-				}
-			}
+// injectIntoServerBlocks puts a managed block into every server block listed
+// in CoreDNSServerBlocks and removes managed blocks from anywhere else, so
+// that dropping a server block from the list cleans it up.
+func (r *IngressReconciler) injectIntoServerBlocks(parsed *corefile.Corefile, newRules string) error {
+	targets, err := r.configuredServerBlocks(parsed)
+	if err != nil {
+		return err
+	}
+	if err := removeManagedBlocksExcept(parsed, targets); err != nil {
+		return err
+	}
+
+	for _, block := range targets {
+		managedBlock, needsMetadata, err := newManagedBlock(newRules)
+		if err != nil {
+			return err
 		}
+		var found bool
+		if block.Block, found, err = replaceManagedRegion(block.Block, managedBlock); err != nil {
+			return err
+		}
+		if !found {
+			insertManagedBlock(block, managedBlock)
+		}
+		if needsMetadata {
+			ensureMetadata(parsed, block)
+		}
+	}
+	return nil
+}
 
-		var newCorefileBuilder strings.Builder
-		if insertionPoint != -1 {
-			// Inject after the 'kubernetes' plugin block.
-			newCorefileBuilder.WriteString(strings.Join(lines[:insertionPoint], "\n"))
-			if newCorefileBuilder.Len() > 0 {
-				newCorefileBuilder.WriteString("\n")
-			}
-			newCorefileBuilder.WriteString(blockToAdd)
-			if insertionPoint < len(lines) {
-				newCorefileBuilder.WriteString("\n")
-				newCorefileBuilder.WriteString(strings.Join(lines[insertionPoint:], "\n"))
-			}
-		} else {
-			// Fallback: Append to the end of the file.
-			trimmedContent := strings.TrimSpace(corefileContent)
-			if trimmedContent != "" {
-				newCorefileBuilder.WriteString(trimmedContent)
-				newCorefileBuilder.WriteString("\n")
-			}
-			newCorefileBuilder.WriteString(blockToAdd)
+// configuredServerBlocks returns the server blocks listed in
+// CoreDNSServerBlocks, failing if one of them is not in the Corefile.
+func (r *IngressReconciler) configuredServerBlocks(parsed *corefile.Corefile) ([]*corefile.Node, error) {
+	var targets []*corefile.Node
+	for _, key := range r.CoreDNSServerBlocks {
+		block := parsed.ServerBlock(corefile.ParseServerKey(key))
+		if block == nil {
+			return nil, fmt.Errorf("server block %q not found in the Corefile", key)
 		}
-		updatedCorefile = newCorefileBuilder.String()
-	}
-
-	// 3. Ensure the 'metadata' plugin is present if needed.
-	needsMetadata := strings.Contains(newRules, "expression")
-	hasMetadata := strings.Contains(updatedCorefile, "metadata")
-
-	finalCorefile := updatedCorefile
-	if needsMetadata && !hasMetadata {
-		// If metadata is needed but not present, inject it before the kubernetes plugin.
-		lines := strings.Split(updatedCorefile, "\n")
-		kubernetesLine := -1
-		for i, line := range lines {
-			if strings.Contains(line, "kubernetes") {
-				kubernetesLine = i
-				break
-			}
+		if !slices.Contains(targets, block) {
+			targets = append(targets, block)
 		}
+	}
+	return targets, nil
+}
 
-		if kubernetesLine != -1 {
-			var builder strings.Builder
-			builder.WriteString(strings.Join(lines[:kubernetesLine], "\n"))
-			if builder.Len() > 0 {
-				builder.WriteString("\n")
-			}
-			// Inject metadata with the same indentation as the kubernetes line.
-			indent := strings.Repeat(" ", len(lines[kubernetesLine])-len(strings.TrimLeft(lines[kubernetesLine], " ")))
-			builder.WriteString(indent + "metadata\n")
-			builder.WriteString(strings.Join(lines[kubernetesLine:], "\n"))
-			finalCorefile = builder.String()
-		} else {
-			// Fallback: if kubernetes plugin is not found, inject it before the managed block.
-			finalCorefile = strings.Replace(updatedCorefile, managedRulesBeginMarker, "    metadata\n"+managedRulesBeginMarker, 1)
+// removeManagedBlocksExcept removes the managed blocks found at the top level
+// of the Corefile and in every server block but the given ones.
+func removeManagedBlocksExcept(parsed *corefile.Corefile, keep []*corefile.Node) error {
+	var err error
+	if parsed.Nodes, err = removeManagedBlocks(parsed.Nodes); err != nil {
+		return err
+	}
+	for _, block := range parsed.ServerBlocks() {
+		if slices.Contains(keep, block) {
+			continue
+		}
+		if block.Block, err = removeManagedBlocks(block.Block); err != nil {
+			return err
 		}
 	}
+	return nil
+}
 
-	// 4. Normalize and return the final content.
-	finalOutput := strings.TrimSpace(finalCorefile)
-	if finalOutput != "" {
-		return finalOutput + "\n"
+// isManagedMarker reports whether a node is a comment holding the given marker.
+func isManagedMarker(node *corefile.Node, marker string) bool {
+	return node.IsComment() && strings.Contains(node.Comment, marker)
+}
+
+// replaceManagedRegion replaces the first managed block among nodes with the
+// given nodes and reports whether one was found. A one-line comment holding
+// both markers counts as an empty managed block.
+func replaceManagedRegion(nodes, managedBlock []*corefile.Node) ([]*corefile.Node, bool, error) {
+	begin := slices.IndexFunc(nodes, func(n *corefile.Node) bool { return isManagedMarker(n, managedRulesBeginMarker) })
+	if begin == -1 {
+		return nodes, false, nil
 	}
-	return ""
+	end := slices.IndexFunc(nodes[begin:], func(n *corefile.Node) bool { return isManagedMarker(n, managedRulesEndMarker) })
+	if end == -1 {
+		return nil, false, fmt.Errorf("%q found without %q", managedRulesBeginMarker, managedRulesEndMarker)
+	}
+	return slices.Replace(nodes, begin, begin+end+1, managedBlock...), true, nil
+}
+
+// removeManagedBlocks removes every managed block among nodes.
+func removeManagedBlocks(nodes []*corefile.Node) ([]*corefile.Node, error) {
+	for {
+		updated, found, err := replaceManagedRegion(nodes, nil)
+		if err != nil || !found {
+			return nodes, err
+		}
+		nodes = updated
+	}
+}
+
+// replaceManagedBlock replaces the first managed block of the Corefile with
+// the given nodes, and returns the directive whose block held it (nil at the
+// top level) and whether one was found.
+func replaceManagedBlock(parsed *corefile.Corefile, managedBlock []*corefile.Node) (*corefile.Node, bool, error) {
+	nodes, found, err := replaceManagedRegion(parsed.Nodes, managedBlock)
+	if found || err != nil {
+		parsed.Nodes = nodes
+		return nil, found, err
+	}
+
+	var block *corefile.Node
+	parsed.Walk(func(parent *corefile.Node, siblings []*corefile.Node, i int) bool {
+		node := siblings[i]
+		if found || err != nil || !node.HasBlock() {
+			return false
+		}
+		if node.Block, found, err = replaceManagedRegion(node.Block, managedBlock); found {
+			block = node
+		}
+		return true
+	})
+	return block, found, err
+}
+
+// insertManagedBlock inserts the managed block into a server block, right
+// after its kubernetes plugin or else at its end.
+func insertManagedBlock(block *corefile.Node, managedBlock []*corefile.Node) {
+	if _, i := block.Directive("kubernetes"); i != -1 {
+		block.Block = slices.Insert(block.Block, i+1, managedBlock...)
+		return
+	}
+	block.Block = append(block.Block, managedBlock...)
+}
+
+// ensureMetadata enables the metadata plugin, which expression rules rely on,
+// in the server block holding the managed rules unless it is already there.
+// It goes before the kubernetes plugin, or else before the managed block or
+// the import of the managed ConfigMap, or else at the end of the block.
+func ensureMetadata(parsed *corefile.Corefile, block *corefile.Node) {
+	nodes := &parsed.Nodes
+	if block != nil {
+		nodes = &block.Block
+	}
+	if slices.ContainsFunc(*nodes, func(n *corefile.Node) bool { return n.Name == "metadata" }) {
+		return
+	}
+
+	i := slices.IndexFunc(*nodes, func(n *corefile.Node) bool { return n.Name == "kubernetes" })
+	if i == -1 {
+		i = slices.IndexFunc(*nodes, func(n *corefile.Node) bool {
+			return isManagedMarker(n, managedRulesBeginMarker) || n.Name == "import"
+		})
+	}
+	if i == -1 {
+		i = len(*nodes)
+	}
+	*nodes = slices.Insert(*nodes, i, corefile.NewDirective("metadata"))
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *IngressReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&networkingv1.Ingress{}).
-		Named("ingress").
-		Complete(r)
+	provider, err := r.dnsProvider()
+	if err != nil {
+		return err
+	}
+	if runnable, ok := provider.(manager.Runnable); ok {
+		// Providers serving DNS themselves run alongside the controllers
+		if err := mgr.Add(runnable); err != nil {
+			return err
+		}
+	}
+	enqueue := enqueueDNSUpdate(r.Debounce)
+	b := ctrl.NewControllerManagedBy(mgr).
+		Watches(&networkingv1.Ingress{}, enqueue, builder.WithPredicates(r.ingressInputsChanged()))
+	var servicePredicates []predicate.Predicate
+	if r.resolvesClusterIPs() {
+		// Answers holding ClusterIPs follow the target Services
+		servicePredicates = append(servicePredicates, clusterIPsChanged)
+	}
+	if r.TargetSource == TargetSourceService {
+		// Targets follow the Services holding the load balancer addresses
+		servicePredicates = append(servicePredicates, loadBalancerAddressesChanged)
+	}
+	if configMaps := r.providerConfigMaps(); len(configMaps) > 0 {
+		// Edits of the provider's ConfigMaps are repaired right away
+		b = b.Watches(&corev1.ConfigMap{}, enqueue,
+			builder.WithPredicates(r.isProviderConfigMap()))
+	}
+	if len(servicePredicates) > 0 {
+		b = b.Watches(&corev1.Service{}, enqueue, builder.WithPredicates(predicate.Or(servicePredicates...)))
+	}
+	return b.Named("ingress").Complete(r)
 }
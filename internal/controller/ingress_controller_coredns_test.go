@@ -245,18 +245,117 @@ func TestInjectRewriteRules(t *testing.T) {
 				"}\n",
 		},
 		{
-			name: "Corefile with no kubernetes plugin (fallback to append)",
+			// Rules used to be appended after the server block, outside of it,
+			// which CoreDNS rejects: they now go at the end of the block.
+			name: "Corefile with no kubernetes plugin (fallback to the end of the first server block)",
 			corefile: ".:53 {\n" +
 				"    forward . /etc/resolv.conf\n" +
 				"}\n",
 			newRules: "rewrite name no.k8s no.k8s.svc",
 			expectedCorefile: ".:53 {\n" +
 				"    forward . /etc/resolv.conf\n" +
-				"}\n" + // Trailing newline from original processing
+				managedRulesBeginMarker + "\n" +
+				"rewrite name no.k8s no.k8s.svc\n" +
+				managedRulesEndMarker + "\n" +
+				"}\n",
+		},
+		{
+			name: "several server blocks without kubernetes plugin (fallback to the first one)",
+			corefile: "corp.internal:53 {\n" +
+				"    forward . 10.0.0.10\n" +
+				"}\n" +
+				".:53 {\n" +
+				"    forward . /etc/resolv.conf\n" +
+				"}\n",
+			newRules: "rewrite name no.k8s no.k8s.svc",
+			expectedCorefile: "corp.internal:53 {\n" +
+				"    forward . 10.0.0.10\n" +
+				managedRulesBeginMarker + "\n" +
+				"rewrite name no.k8s no.k8s.svc\n" +
+				managedRulesEndMarker + "\n" +
+				"}\n" +
+				".:53 {\n" +
+				"    forward . /etc/resolv.conf\n" +
+				"}\n",
+		},
+		{
+			name:     "Corefile without server blocks (fallback to append)",
+			corefile: "# no server block yet\n",
+			newRules: "rewrite name no.k8s no.k8s.svc",
+			expectedCorefile: "# no server block yet\n" +
 				managedRulesBeginMarker + "\n" +
 				"rewrite name no.k8s no.k8s.svc\n" +
 				managedRulesEndMarker + "\n",
 		},
+		{
+			name:     "one-line server block without kubernetes plugin (fallback to the end of it)",
+			corefile: ".:53 { forward . /etc/resolv.conf }\n",
+			newRules: "rewrite name no.k8s no.k8s.svc",
+			expectedCorefile: ".:53 {\n" +
+				"    forward . /etc/resolv.conf\n" +
+				managedRulesBeginMarker + "\n" +
+				"rewrite name no.k8s no.k8s.svc\n" +
+				managedRulesEndMarker + "\n" +
+				"}\n",
+		},
+		{
+			name: "kubernetes in comments and other plugins is ignored",
+			corefile: "# kubernetes zones are served below\n" +
+				".:53 {\n" +
+				"    errors\n" +
+				"    # kubernetes cluster.local\n" +
+				"    forward . kubernetes.default.svc {\n" +
+				"        except kubernetes\n" +
+				"    }\n" +
+				"    kubernetes cluster.local in-addr.arpa ip6.arpa {\n" +
+				"        pods insecure\n" +
+				"    }\n" +
+				"    cache 30\n" +
+				"}\n",
+			newRules: "rewrite name host1 service1",
+			expectedCorefile: "# kubernetes zones are served below\n" +
+				".:53 {\n" +
+				"    errors\n" +
+				"    # kubernetes cluster.local\n" +
+				"    forward . kubernetes.default.svc {\n" +
+				"        except kubernetes\n" +
+				"    }\n" +
+				"    kubernetes cluster.local in-addr.arpa ip6.arpa {\n" +
+				"        pods insecure\n" +
+				"    }\n" +
+				managedRulesBeginMarker + "\n" +
+				"rewrite name host1 service1\n" +
+				managedRulesEndMarker + "\n" +
+				"    cache 30\n" +
+				"}\n",
+		},
+		{
+			name: "multiple server blocks, formatting of untouched blocks is preserved",
+			corefile: "corp.internal:53 {\n" +
+				"\terrors\n" +
+				"\tforward . 10.0.0.10   # corporate resolvers\n" +
+				"}\n" +
+				"\n" +
+				".:53 {\n" +
+				"  errors\n" +
+				"  kubernetes cluster.local\n" +
+				"  forward . /etc/resolv.conf\n" +
+				"}\n",
+			newRules: "rewrite name host1 service1",
+			expectedCorefile: "corp.internal:53 {\n" +
+				"\terrors\n" +
+				"\tforward . 10.0.0.10   # corporate resolvers\n" +
+				"}\n" +
+				"\n" +
+				".:53 {\n" +
+				"  errors\n" +
+				"  kubernetes cluster.local\n" +
+				managedRulesBeginMarker + "\n" +
+				"rewrite name host1 service1\n" +
+				managedRulesEndMarker + "\n" +
+				"  forward . /etc/resolv.conf\n" +
+				"}\n",
+		},
 		{
 			name:     "Corefile completely empty, inject new rules with markers",
 			corefile: "",
@@ -364,7 +463,10 @@ func TestInjectRewriteRules(t *testing.T) {
 				expected = ""
 			}
 
-			actual := r.injectRewriteRules(corefileInput, tt.newRules)
+			actual, err := r.injectRewriteRules(corefileInput, tt.newRules)
+			if err != nil {
+				t.Fatalf("injectRewriteRules() returned error: %v", err)
+			}
 			actual = strings.TrimSpace(actual) // Trim for comparison
 			if actual != "" {
 				actual += "\n"
@@ -376,3 +478,141 @@ func TestInjectRewriteRules(t *testing.T) {
 		})
 	}
 }
+
+func TestInjectRewriteRulesErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		corefile string
+		newRules string
+	}{
+		{
+			name:     "unbalanced braces",
+			corefile: ".:53 {\n    errors\n",
+		},
+		{
+			name:     "begin marker without end marker",
+			corefile: ".:53 {\n    " + managedRulesBeginMarker + "\n    rewrite name a b\n}\n",
+		},
+		{
+			name:     "malformed rules",
+			corefile: ".:53 {\n    errors\n}\n",
+			newRules: "rewrite name a b }",
+		},
+	}
+
+	r := &IngressReconciler{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := r.injectRewriteRules(tt.corefile, tt.newRules); err == nil {
+				t.Errorf("injectRewriteRules() expected an error")
+			}
+		})
+	}
+}
+
+func TestInjectRewriteRulesIntoServerBlocks(t *testing.T) {
+	corefile := ".:53 {\n" +
+		"    errors\n" +
+		"    kubernetes cluster.local in-addr.arpa ip6.arpa\n" +
+		"    " + managedRulesBeginMarker + "\n" +
+		"    rewrite name old old.svc\n" +
+		"    " + managedRulesEndMarker + "\n" +
+		"    forward . /etc/resolv.conf\n" +
+		"}\n" +
+		"corp.internal:53 {\n" +
+		"    errors\n" +
+		"    forward . 10.0.0.10\n" +
+		"}\n" +
+		"cluster.local:8053 {\n" +
+		"    bind 169.254.20.10\n" +
+		"    forward . 10.96.0.10\n" +
+		"}\n"
+
+	tests := []struct {
+		name             string
+		serverBlocks     []string
+		newRules         string
+		expectedCorefile string
+		expectErr        bool
+	}{
+		{
+			name:         "several server blocks, stale block removed",
+			serverBlocks: []string{"corp.internal:53", "cluster.local:8053"},
+			newRules:     "rewrite name new new.svc",
+			expectedCorefile: ".:53 {\n" +
+				"    errors\n" +
+				"    kubernetes cluster.local in-addr.arpa ip6.arpa\n" +
+				"    forward . /etc/resolv.conf\n" +
+				"}\n" +
+				"corp.internal:53 {\n" +
+				"    errors\n" +
+				"    forward . 10.0.0.10\n" +
+				managedRulesBeginMarker + "\n" +
+				"rewrite name new new.svc\n" +
+				managedRulesEndMarker + "\n" +
+				"}\n" +
+				"cluster.local:8053 {\n" +
+				"    bind 169.254.20.10\n" +
+				"    forward . 10.96.0.10\n" +
+				managedRulesBeginMarker + "\n" +
+				"rewrite name new new.svc\n" +
+				managedRulesEndMarker + "\n" +
+				"}\n",
+		},
+		{
+			name:         "existing block replaced in place, metadata added per block",
+			serverBlocks: []string{".", "corp.internal."},
+			newRules:     "expression \"a\" {\n    rewrite name new new.svc\n}",
+			expectedCorefile: ".:53 {\n" +
+				"    errors\n" +
+				"    metadata\n" +
+				"    kubernetes cluster.local in-addr.arpa ip6.arpa\n" +
+				managedRulesBeginMarker + "\n" +
+				"expression \"a\" {\n" +
+				"    rewrite name new new.svc\n" +
+				"}\n" +
+				managedRulesEndMarker + "\n" +
+				"    forward . /etc/resolv.conf\n" +
+				"}\n" +
+				"corp.internal:53 {\n" +
+				"    errors\n" +
+				"    forward . 10.0.0.10\n" +
+				"    metadata\n" +
+				managedRulesBeginMarker + "\n" +
+				"expression \"a\" {\n" +
+				"    rewrite name new new.svc\n" +
+				"}\n" +
+				managedRulesEndMarker + "\n" +
+				"}\n" +
+				"cluster.local:8053 {\n" +
+				"    bind 169.254.20.10\n" +
+				"    forward . 10.96.0.10\n" +
+				"}\n",
+		},
+		{
+			name:         "missing server block",
+			serverBlocks: []string{".:53", "corp.internal:5353"},
+			newRules:     "rewrite name new new.svc",
+			expectErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &IngressReconciler{CoreDNSServerBlocks: tt.serverBlocks}
+			actual, err := r.injectRewriteRules(corefile, tt.newRules)
+			if tt.expectErr {
+				if err == nil {
+					t.Errorf("injectRewriteRules() expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("injectRewriteRules() returned error: %v", err)
+			}
+			if actual != tt.expectedCorefile {
+				t.Errorf("injectRewriteRules():\nExpected:\n```\n%s```\nActual:\n```\n%s```", tt.expectedCorefile, actual)
+			}
+		})
+	}
+}
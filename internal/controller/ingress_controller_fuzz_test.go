@@ -0,0 +1,74 @@
+package controller
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var (
+	// wellFormedRewriteLine matches the only lines allowed inside the managed block.
+	wellFormedRewriteLine = regexp.MustCompile(
+		`^rewrite name [a-z0-9][a-z0-9.-]* [a-z0-9][a-z0-9.-]*$` +
+			`|^rewrite name regex \^(\[\^\.\]\+|\.\+)\\\.[a-z0-9][a-z0-9\\.-]*\\\.\$ [a-z0-9][a-z0-9.-]*\. answer auto$`)
+
+	fuzzCorefile = ".:53 {\n" +
+		"    errors\n" +
+		"    kubernetes cluster.local in-addr.arpa ip6.arpa {\n" +
+		"        pods insecure\n" +
+		"    }\n" +
+		"    forward . /etc/resolv.conf\n" +
+		"}\n"
+)
+
+// managedBlockLines returns the lines between the managed block markers.
+func managedBlockLines(t *testing.T, corefile string) []string {
+	t.Helper()
+	begin := strings.Index(corefile, managedRulesBeginMarker)
+	end := strings.Index(corefile, managedRulesEndMarker)
+	if begin == -1 || end == -1 || end < begin {
+		t.Fatalf("managed block not found in:\n%s", corefile)
+	}
+	block := strings.TrimSpace(corefile[begin+len(managedRulesBeginMarker) : end])
+	if block == "" {
+		return nil
+	}
+	lines := strings.Split(block, "\n")
+	for i := range lines {
+		lines[i] = strings.TrimSpace(lines[i])
+	}
+	return lines
+}
+
+func FuzzManagedBlockRewriteRules(f *testing.F) {
+	for _, seed := range []struct{ host, target string }{
+		{"www.example.com", "ingress-nginx-controller.ingress-nginx.svc.cluster.local"},
+		{"*.apps.example.com", "traefik.traefik.svc.cluster.local."},
+		{"evil.example.com svc\n}\n. {\n    forward . 1.1.1.1", "svc.cluster.local"},
+		{"a.example.com", "b # comment"},
+		{"*.*.example.com", "svc"},
+		{"\"quoted\".example.com", "{1}.svc"},
+	} {
+		f.Add(seed.host, seed.target, false)
+		f.Add(seed.host, seed.target, true)
+	}
+
+	r := &IngressReconciler{}
+	f.Fuzz(func(t *testing.T, host, target string, suffixMatch bool) {
+		rules := r.allowedRewriteRules([]rewriteRule{{Host: host, Target: target, SuffixMatch: suffixMatch}})
+		corefile, err := r.injectRewriteRules(fuzzCorefile, renderRewriteRules(rules))
+		if err != nil {
+			t.Fatalf("injectRewriteRules() returned error: %v", err)
+		}
+
+		lines := managedBlockLines(t, corefile)
+		if len(lines) != len(rules) {
+			t.Fatalf("expected %d rewrite lines, got %d:\n%s", len(rules), len(lines), corefile)
+		}
+		for _, line := range lines {
+			if !wellFormedRewriteLine.MatchString(line) {
+				t.Fatalf("malformed line in managed block: %q", line)
+			}
+		}
+	})
+}
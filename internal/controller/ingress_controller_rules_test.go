@@ -0,0 +1,429 @@
+package controller
+
+import (
+	"context"
+	"math/rand"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+)
+
+func newIngress(namespace, name string, hosts ...string) networkingv1.Ingress {
+	ingress := networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}}
+	for _, host := range hosts {
+		ingress.Spec.Rules = append(ingress.Spec.Rules, networkingv1.IngressRule{Host: host})
+	}
+	return ingress
+}
+
+// newFakeClientBuilder returns a fake client builder that knows every type kic reads.
+func newFakeClientBuilder(t *testing.T) *fake.ClientBuilder {
+	t.Helper()
+	s := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := gatewayv1.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := gatewayv1alpha2.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	return fake.NewClientBuilder().WithScheme(s)
+}
+
+func newFakeClient(t *testing.T, objs ...client.Object) client.Client {
+	t.Helper()
+	return newFakeClientBuilder(t).WithObjects(objs...).Build()
+}
+
+// withoutSources strips the source objects so rules can be compared by value.
+func withoutSources(rules []rewriteRule) []rewriteRule {
+	stripped := make([]rewriteRule, 0, len(rules))
+	for _, rule := range rules {
+		rule.Source = nil
+		stripped = append(stripped, rule)
+	}
+	return stripped
+}
+
+func TestIngressRewriteRulesPerClass(t *testing.T) {
+	traefik := "traefik"
+	unmapped := "haproxy"
+
+	byClassName := newIngress("apps", "internal", "internal.example.com")
+	byClassName.Spec.IngressClassName = &traefik
+
+	byLegacyAnnotation := newIngress("apps", "legacy", "legacy.example.com")
+	byLegacyAnnotation.Annotations = map[string]string{legacyIngressClassAnnotation: "traefik"}
+
+	// spec.ingressClassName wins over the legacy annotation.
+	conflicting := newIngress("apps", "both", "both.example.com")
+	conflicting.Spec.IngressClassName = &unmapped
+	conflicting.Annotations = map[string]string{legacyIngressClassAnnotation: "traefik"}
+
+	ingresses := []networkingv1.Ingress{
+		newIngress("apps", "public", "www.example.com", ""),
+		byClassName,
+		byLegacyAnnotation,
+		conflicting,
+	}
+
+	r := &IngressReconciler{
+		IngressControllerServiceName: "ingress-nginx-controller.ingress-nginx.svc.cluster.local",
+		IngressClassServiceNames: map[string]string{
+			"traefik": "traefik.traefik.svc.cluster.local",
+		},
+	}
+
+	expected := []rewriteRule{
+		{Host: "www.example.com", Target: "ingress-nginx-controller.ingress-nginx.svc.cluster.local"},
+		{Host: "internal.example.com", Target: "traefik.traefik.svc.cluster.local"},
+		{Host: "legacy.example.com", Target: "traefik.traefik.svc.cluster.local"},
+		{Host: "both.example.com", Target: "ingress-nginx-controller.ingress-nginx.svc.cluster.local"},
+	}
+
+	rules := withoutSources(r.ingressRewriteRules(ingresses, nil))
+	if !reflect.DeepEqual(rules, expected) {
+		t.Errorf("ingressRewriteRules():\nExpected: %v\nActual:   %v", expected, rules)
+	}
+}
+
+func TestIngressRewriteRulesTargetAnnotation(t *testing.T) {
+	traefik := "traefik"
+
+	overridden := newIngress("apps", "dedicated", "dedicated.example.com")
+	overridden.Spec.IngressClassName = &traefik
+	overridden.Annotations = map[string]string{targetAnnotation: "internal-gateway.infra.svc.cluster.local"}
+
+	invalid := newIngress("apps", "invalid", "invalid.example.com")
+	invalid.Annotations = map[string]string{targetAnnotation: "evil.svc }\nforward . 1.1.1.1"}
+
+	recorder := record.NewFakeRecorder(10)
+	r := &IngressReconciler{
+		Recorder:                     recorder,
+		IngressControllerServiceName: "ingress-nginx-controller.ingress-nginx.svc.cluster.local",
+		IngressClassServiceNames: map[string]string{
+			"traefik": "traefik.traefik.svc.cluster.local",
+		},
+	}
+
+	expected := []rewriteRule{
+		{Host: "dedicated.example.com", Target: "internal-gateway.infra.svc.cluster.local"},
+		{Host: "www.example.com", Target: "ingress-nginx-controller.ingress-nginx.svc.cluster.local"},
+	}
+
+	rules := withoutSources(r.ingressRewriteRules([]networkingv1.Ingress{overridden, invalid, newIngress("apps", "public", "www.example.com")}, nil))
+	if !reflect.DeepEqual(rules, expected) {
+		t.Errorf("ingressRewriteRules():\nExpected: %v\nActual:   %v", expected, rules)
+	}
+
+	select {
+	case event := <-recorder.Events:
+		if !strings.HasPrefix(event, "Warning "+reasonInvalidTarget) {
+			t.Errorf("unexpected event %q", event)
+		}
+	default:
+		t.Error("expected an event for the invalid target")
+	}
+}
+
+func TestRenderRewriteRulesWildcards(t *testing.T) {
+	const target = "ingress-nginx-controller.ingress-nginx.svc.cluster.local"
+
+	tests := []struct {
+		name     string
+		rules    []rewriteRule
+		expected string
+	}{
+		{
+			name:     "exact host",
+			rules:    []rewriteRule{{Host: "www.example.com", Target: target}},
+			expected: "rewrite name www.example.com " + target + "\n",
+		},
+		{
+			name:     "ingress wildcard matches a single label",
+			rules:    []rewriteRule{{Host: "*.apps.example.com", Target: target}},
+			expected: `rewrite name regex ^[^.]+\.apps\.example\.com\.$ ` + target + ". answer auto\n",
+		},
+		{
+			name:     "gateway wildcard matches any number of labels",
+			rules:    []rewriteRule{{Host: "*.apps.example.com", Target: target, SuffixMatch: true}},
+			expected: `rewrite name regex ^.+\.apps\.example\.com\.$ ` + target + ". answer auto\n",
+		},
+		{
+			name:     "fully qualified target is not dotted twice",
+			rules:    []rewriteRule{{Host: "*.example.com", Target: target + "."}},
+			expected: `rewrite name regex ^[^.]+\.example\.com\.$ ` + target + ". answer auto\n",
+		},
+		{
+			name: "mixed exact and wildcard hosts keep their order",
+			rules: []rewriteRule{
+				{Host: "apps.example.com", Target: target},
+				{Host: "*.apps.example.com", Target: target},
+				{Host: "api.example.com", Target: "traefik.traefik.svc.cluster.local"},
+			},
+			expected: "rewrite name apps.example.com " + target + "\n" +
+				`rewrite name regex ^[^.]+\.apps\.example\.com\.$ ` + target + ". answer auto\n" +
+				"rewrite name api.example.com traefik.traefik.svc.cluster.local\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual := renderRewriteRules(tt.rules)
+			if actual != tt.expected {
+				t.Errorf("renderRewriteRules():\nExpected:\n%s\nActual:\n%s", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestRewriteRuleWildcardMatching(t *testing.T) {
+	tests := []struct {
+		rule    rewriteRule
+		query   string
+		matches bool
+	}{
+		{rewriteRule{Host: "*.apps.example.com"}, "web.apps.example.com.", true},
+		{rewriteRule{Host: "*.apps.example.com"}, "a.b.apps.example.com.", false},
+		{rewriteRule{Host: "*.apps.example.com"}, "apps.example.com.", false},
+		{rewriteRule{Host: "*.apps.example.com"}, "web.appsXexample.com.", false},
+		{rewriteRule{Host: "*.apps.example.com"}, "web.apps.example.com.evil.", false},
+		{rewriteRule{Host: "*.apps.example.com", SuffixMatch: true}, "a.b.apps.example.com.", true},
+		{rewriteRule{Host: "*.apps.example.com", SuffixMatch: true}, "apps.example.com.", false},
+	}
+
+	for _, tt := range tests {
+		fields := strings.Fields(tt.rule.String())
+		pattern := regexp.MustCompile(fields[3])
+		if pattern.MatchString(tt.query) != tt.matches {
+			t.Errorf("rule for %q (suffix match %v) matching %q: expected %v", tt.rule.Host, tt.rule.SuffixMatch, tt.query, tt.matches)
+		}
+	}
+}
+
+func TestAllowedRewriteRulesValidation(t *testing.T) {
+	const target = "ingress-nginx-controller.ingress-nginx.svc.cluster.local"
+	source := newIngress("apps", "tenant")
+
+	recorder := record.NewFakeRecorder(10)
+	r := &IngressReconciler{Recorder: recorder}
+
+	rules := []rewriteRule{
+		{Host: "www.example.com", Target: target, Source: &source},
+		{Host: "*.apps.example.com", Target: target, Source: &source},
+		{Host: "evil.example.com " + target + "\n}\n. {\n    forward . 1.1.1.1", Target: target, Source: &source},
+		{Host: "UPPER.example.com", Target: target, Source: &source},
+		{Host: "a.*.example.com", Target: target, Source: &source},
+		{Host: "brace{.example.com", Target: target, Source: &source},
+		{Host: "ok.example.com", Target: "bad target", Source: &source},
+	}
+
+	expected := []rewriteRule{
+		{Host: "www.example.com", Target: target},
+		{Host: "*.apps.example.com", Target: target},
+	}
+
+	valid := withoutSources(r.allowedRewriteRules(rules))
+	if !reflect.DeepEqual(valid, expected) {
+		t.Errorf("allowedRewriteRules():\nExpected: %v\nActual:   %v", expected, valid)
+	}
+
+	if len(recorder.Events) != 5 {
+		t.Errorf("expected 5 events, got %d", len(recorder.Events))
+	}
+	for len(recorder.Events) > 0 {
+		if event := <-recorder.Events; !strings.HasPrefix(event, "Warning "+reasonHostRejected) {
+			t.Errorf("unexpected event %q", event)
+		}
+	}
+}
+
+func TestRewriteRuleOverlaps(t *testing.T) {
+	tests := []struct {
+		host        string
+		suffixMatch bool
+		domain      string
+		overlaps    bool
+	}{
+		{"kubernetes.default.svc.cluster.local", false, "cluster.local", true},
+		{"cluster.local", false, "cluster.local", true},
+		{"CLUSTER.local.", false, "cluster.local.", true},
+		{"mycluster.local", false, "cluster.local", false},
+		{"cluster.local.example.com", false, "cluster.local", false},
+		{"*.svc.cluster.local", false, "cluster.local", true},
+		{"*.local", false, "cluster.local", true},
+		{"*.local", false, "svc.cluster.local", false},
+		{"*.local", true, "svc.cluster.local", true},
+		{"*.example.com", true, "cluster.local", false},
+		{"1.0.10.in-addr.arpa", false, "in-addr.arpa", true},
+	}
+
+	for _, tt := range tests {
+		rule := rewriteRule{Host: tt.host, SuffixMatch: tt.suffixMatch}
+		if rule.overlaps(tt.domain) != tt.overlaps {
+			t.Errorf("rule for %q (suffix match %v) overlapping %q: expected %v", tt.host, tt.suffixMatch, tt.domain, tt.overlaps)
+		}
+	}
+}
+
+func TestAllowedRewriteRulesProtectedDomains(t *testing.T) {
+	const target = "ingress-nginx-controller.ingress-nginx.svc.cluster.local"
+	source := newIngress("apps", "tenant")
+
+	recorder := record.NewFakeRecorder(10)
+	r := &IngressReconciler{
+		Recorder:         recorder,
+		ProtectedDomains: []string{"cluster.local", "in-addr.arpa", "ip6.arpa"},
+	}
+
+	rules := []rewriteRule{
+		{Host: "www.example.com", Target: target, Source: &source},
+		{Host: "kubernetes.default.svc.cluster.local", Target: target, Source: &source},
+		{Host: "*.svc.cluster.local", Target: target, Source: &source},
+		{Host: "10.in-addr.arpa", Target: target, Source: &source},
+		{Host: "bad host", Target: target, Source: &source},
+	}
+
+	expected := []rewriteRule{{Host: "www.example.com", Target: target}}
+	allowed := withoutSources(r.allowedRewriteRules(rules))
+	if !reflect.DeepEqual(allowed, expected) {
+		t.Errorf("allowedRewriteRules():\nExpected: %v\nActual:   %v", expected, allowed)
+	}
+
+	if got := testutil.ToFloat64(rejectedHosts.WithLabelValues(rejectReasonProtected)); got != 3 {
+		t.Errorf("expected 3 protected hosts in metric, got %v", got)
+	}
+	if got := testutil.ToFloat64(rejectedHosts.WithLabelValues(rejectReasonInvalid)); got != 1 {
+		t.Errorf("expected 1 invalid host in metric, got %v", got)
+	}
+	if len(recorder.Events) != 4 {
+		t.Errorf("expected 4 events, got %d", len(recorder.Events))
+	}
+}
+
+func TestSortRewriteRules(t *testing.T) {
+	expected := []rewriteRule{
+		{Host: "a.example.com"},
+		{Host: "web.apps.example.com"},
+		{Host: "www.example.com"},
+		{Host: "*.apps.example.com"},
+		{Host: "*.apps.example.com", SuffixMatch: true},
+		{Host: "*.example.com"},
+	}
+
+	for i := 0; i < 10; i++ {
+		rules := slices.Clone(expected)
+		rand.Shuffle(len(rules), func(i, j int) { rules[i], rules[j] = rules[j], rules[i] })
+		sortRewriteRules(rules)
+		if !reflect.DeepEqual(rules, expected) {
+			t.Fatalf("sortRewriteRules():\nExpected: %v\nActual:   %v", expected, rules)
+		}
+	}
+}
+
+func TestCorefilesEquivalent(t *testing.T) {
+	base := ".:53 {\n    errors\n" + managedRulesBeginMarker + "\nrewrite name a.example.com svc\n" + managedRulesEndMarker + "\n}\n"
+
+	tests := []struct {
+		name       string
+		other      string
+		equivalent bool
+	}{
+		{"identical", base, true},
+		{"indentation and blank lines", ".:53 {\n\terrors\n\n" + managedRulesBeginMarker + "\n    rewrite name a.example.com svc  \n" +
+			managedRulesEndMarker + "\n}", true},
+		{"different rule", strings.Replace(base, "a.example.com", "b.example.com", 1), false},
+		{"additional rule", strings.Replace(base, "svc\n", "svc\nrewrite name b.example.com svc\n", 1), false},
+	}
+
+	for _, tt := range tests {
+		if corefilesEquivalent(base, tt.other) != tt.equivalent {
+			t.Errorf("%s: expected equivalent %v", tt.name, tt.equivalent)
+		}
+	}
+}
+
+func TestUpdateCoreDNSConfigMapIsDeterministic(t *testing.T) {
+	const target = "ingress-nginx-controller.ingress-nginx.svc.cluster.local"
+
+	zeta := newIngress("apps", "zeta", "www.example.com", "*.apps.example.com")
+	alpha := newIngress("apps", "alpha", "api.example.com", "www.example.com")
+	corefile := ".:53 {\n" +
+		"    errors\n" +
+		"    kubernetes cluster.local in-addr.arpa ip6.arpa\n" +
+		"        " + managedRulesBeginMarker + "\n" +
+		"        rewrite name www.example.com " + target + "\n" +
+		"        rewrite name api.example.com " + target + "\n" +
+		"        " + managedRulesEndMarker + "\n" +
+		"    forward . /etc/resolv.conf\n" +
+		"}\n"
+	coreDNS := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: coreDNSConfigMapName, Namespace: coreDNSConfigMapNamespace},
+		Data:       map[string]string{corefileKey: corefile},
+	}
+
+	updates := 0
+	c := newFakeClientBuilder(t).
+		WithObjects(&zeta, &alpha, coreDNS).
+		WithInterceptorFuncs(interceptor.Funcs{
+			Update: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.UpdateOption) error {
+				updates++
+				return c.Update(ctx, obj, opts...)
+			},
+		}).
+		Build()
+	r := &IngressReconciler{Client: c, IngressControllerServiceName: target}
+
+	for i := 0; i < 3; i++ {
+		if err := r.updateDNS(context.Background()); err != nil {
+			t.Fatalf("updateDNS() returned error: %v", err)
+		}
+	}
+	if updates != 1 {
+		t.Errorf("expected a single ConfigMap update, got %d", updates)
+	}
+
+	var updated corev1.ConfigMap
+	if err := c.Get(context.Background(), client.ObjectKeyFromObject(coreDNS), &updated); err != nil {
+		t.Fatal(err)
+	}
+	expectedRules := []string{
+		"rewrite name api.example.com " + target,
+		"rewrite name www.example.com " + target,
+		`rewrite name regex ^[^.]+\.apps\.example\.com\.$ ` + target + ". answer auto",
+	}
+	if lines := managedBlockLines(t, updated.Data[corefileKey]); !reflect.DeepEqual(lines, expectedRules) {
+		t.Errorf("unexpected managed block in:\n%s", updated.Data[corefileKey])
+	}
+
+	// A managed block that only differs in formatting is left alone.
+	formatted := strings.ReplaceAll(updated.Data[corefileKey], "rewrite name", "    rewrite name")
+	updated.Data[corefileKey] = formatted
+	if err := c.Update(context.Background(), &updated); err != nil {
+		t.Fatal(err)
+	}
+	updates = 0
+	if err := r.updateDNS(context.Background()); err != nil {
+		t.Fatalf("updateDNS() returned error: %v", err)
+	}
+	if updates != 0 {
+		t.Errorf("expected no ConfigMap update for a formatting-only difference, got %d", updates)
+	}
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"reflect"
+	"strings"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// kicAnnotationPrefix is the prefix of the annotations kic reads, such as targetAnnotation.
+const kicAnnotationPrefix = "kic.pelo.tech/"
+
+// ingressInputs is everything of an Ingress the DNS records depend on.
+type ingressInputs struct {
+	Namespace      string
+	Hosts          []string
+	Class          string
+	Filtered       bool
+	KICAnnotations map[string]string
+	Deleting       bool
+	LoadBalancer   []networkingv1.IngressLoadBalancerIngress
+}
+
+// ingressInputs returns the inputs of an Ingress. The load balancer addresses
+// are only included when TargetSource uses them, and the statusAnnotation,
+// which kic writes itself, is left out.
+func (r *IngressReconciler) ingressInputs(ingress *networkingv1.Ingress) ingressInputs {
+	inputs := ingressInputs{
+		Namespace:      ingress.Namespace,
+		Class:          ingressClass(ingress),
+		Filtered:       r.hasRequiredAnnotation(ingress),
+		KICAnnotations: map[string]string{},
+		Deleting:       ingress.DeletionTimestamp != nil,
+	}
+	for _, rule := range ingress.Spec.Rules {
+		inputs.Hosts = append(inputs.Hosts, rule.Host)
+	}
+	for key, value := range ingress.Annotations {
+		if strings.HasPrefix(key, kicAnnotationPrefix) && key != statusAnnotation {
+			inputs.KICAnnotations[key] = value
+		}
+	}
+	if r.TargetSource == TargetSourceStatus || r.TargetSource == TargetSourceService {
+		inputs.LoadBalancer = ingress.Status.LoadBalancer.Ingress
+	}
+	return inputs
+}
+
+// ingressInputsChanged lets Ingress updates through only when they change
+// the inputs of the DNS records, ignoring status churn from the ingress
+// controller and annotations written by other tools. Creations and deletions
+// always go through.
+func (r *IngressReconciler) ingressInputsChanged() predicate.Predicate {
+	return predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			oldIngress, okOld := e.ObjectOld.(*networkingv1.Ingress)
+			newIngress, okNew := e.ObjectNew.(*networkingv1.Ingress)
+			return !okOld || !okNew || !reflect.DeepEqual(r.ingressInputs(oldIngress), r.ingressInputs(newIngress))
+		},
+	}
+}
@@ -0,0 +1,69 @@
+package controller
+
+import (
+	"testing"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+func TestIngressInputsChanged(t *testing.T) {
+	base := newIngress("apps", "web", "www.example.com")
+	base.Annotations = map[string]string{"kic": "true"}
+	base.Spec.IngressClassName = ptr.To("nginx")
+	base.Status.LoadBalancer.Ingress = []networkingv1.IngressLoadBalancerIngress{{IP: "192.0.2.10"}}
+
+	tests := []struct {
+		name         string
+		targetSource string
+		update       func(ingress *networkingv1.Ingress)
+		expected     bool
+	}{
+		{name: "no change", update: func(*networkingv1.Ingress) {}, expected: false},
+		{
+			name: "host added",
+			update: func(i *networkingv1.Ingress) {
+				i.Spec.Rules = append(i.Spec.Rules, networkingv1.IngressRule{Host: "api.example.com"})
+			},
+			expected: true,
+		},
+		{
+			name: "path changed",
+			update: func(i *networkingv1.Ingress) {
+				i.Spec.Rules[0].HTTP = &networkingv1.HTTPIngressRuleValue{Paths: []networkingv1.HTTPIngressPath{{Path: "/api"}}}
+			},
+			expected: false,
+		},
+		{name: "class changed", update: func(i *networkingv1.Ingress) { i.Spec.IngressClassName = ptr.To("traefik") }, expected: true},
+		{name: "filter annotation removed", update: func(i *networkingv1.Ingress) { delete(i.Annotations, "kic") }, expected: true},
+		{name: "target annotation set", update: func(i *networkingv1.Ingress) { i.Annotations[targetAnnotation] = "gateway.infra.svc.cluster.local" }, expected: true},
+		{name: "priority annotation set", update: func(i *networkingv1.Ingress) { i.Annotations[priorityAnnotation] = "10" }, expected: true},
+		{name: "status annotation written by kic", update: func(i *networkingv1.Ingress) { i.Annotations[statusAnnotation] = "[]" }, expected: false},
+		{name: "unrelated annotation", update: func(i *networkingv1.Ingress) { i.Annotations["argocd.argoproj.io/tracking-id"] = "web" }, expected: false},
+		{name: "labels changed", update: func(i *networkingv1.Ingress) { i.Labels = map[string]string{"team": "web"} }, expected: false},
+		{name: "deletion started", update: func(i *networkingv1.Ingress) { i.DeletionTimestamp = &metav1.Time{} }, expected: true},
+		{
+			name:     "load balancer churn",
+			update:   func(i *networkingv1.Ingress) { i.Status.LoadBalancer.Ingress[0].IP = "192.0.2.11" },
+			expected: false,
+		},
+		{
+			name:         "load balancer change with status targets",
+			targetSource: TargetSourceStatus,
+			update:       func(i *networkingv1.Ingress) { i.Status.LoadBalancer.Ingress[0].IP = "192.0.2.11" },
+			expected:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &IngressReconciler{IngressAnnotation: "kic", TargetSource: tt.targetSource}
+			updated := base.DeepCopy()
+			tt.update(updated)
+			if got := r.ingressInputsChanged().Update(event.UpdateEvent{ObjectOld: &base, ObjectNew: updated}); got != tt.expected {
+				t.Errorf("ingressInputsChanged() = %v, expected %v", got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// statusAnnotation holds the kic-owned conditions of an Ingress as a JSON
+	// list of metav1.Condition. The Ingress status has no conditions of its
+	// own, so this is where kic reports on each Ingress.
+	statusAnnotation = "kic.pelo.tech/status"
+
+	// conditionHostConflict is True while a host of the Ingress is rewritten for another object.
+	conditionHostConflict = "HostConflict"
+	// conditionRewriteApplied is True while hosts of the Ingress are rewritten, and lists them with their targets.
+	// It is False with the reason of the DNS provider when a host is skipped.
+	conditionRewriteApplied = "RewriteApplied"
+
+	// reasonRewriteApplied is the event and condition reason used when the rewritten hosts of an Ingress change.
+	reasonRewriteApplied = "RewriteApplied"
+	// reasonNoHostsRewritten is the condition reason used when no host of an Ingress is rewritten.
+	reasonNoHostsRewritten = "NoHostsRewritten"
+)
+
+// ingressConditions decodes the conditions stored in the statusAnnotation of
+// an Ingress. A value that cannot be decoded is discarded and rebuilt.
+func ingressConditions(ingress *networkingv1.Ingress) []metav1.Condition {
+	var conditions []metav1.Condition
+	if raw, ok := ingress.GetAnnotations()[statusAnnotation]; ok {
+		if err := json.Unmarshal([]byte(raw), &conditions); err != nil {
+			return nil
+		}
+	}
+	return conditions
+}
+
+// syncIngressConditions sets the HostConflict condition on every Ingress that
+// lost a host conflict and clears it on all others. The RewriteApplied
+// condition lists the hosts of each Ingress passing the annotation filter that
+// are rewritten by the applied rules, and the hosts the DNS provider skipped,
+// and a RewriteApplied event is recorded whenever the rewritten hosts change.
+func (r *IngressReconciler) syncIngressConditions(ctx context.Context, ingresses []networkingv1.Ingress, rules []rewriteRule, skipped []skippedRule, conflicts []ruleConflict) error {
+	messages := map[types.NamespacedName][]string{}
+	for _, conflict := range conflicts {
+		if ingress, ok := conflict.Loser.Source.(*networkingv1.Ingress); ok {
+			key := client.ObjectKeyFromObject(ingress)
+			messages[key] = append(messages[key], conflict.message())
+		}
+	}
+	rewrites := map[types.NamespacedName][]string{}
+	for _, rule := range rules {
+		if ingress, ok := rule.Source.(*networkingv1.Ingress); ok {
+			key := client.ObjectKeyFromObject(ingress)
+			rewrites[key] = append(rewrites[key], fmt.Sprintf("%s -> %s", rule.Host, rule.destination()))
+		}
+	}
+	skips := map[types.NamespacedName][]skippedRule{}
+	for _, s := range skipped {
+		if ingress, ok := s.Rule.Source.(*networkingv1.Ingress); ok {
+			key := client.ObjectKeyFromObject(ingress)
+			skips[key] = append(skips[key], s)
+		}
+	}
+
+	for i := range ingresses {
+		ingress := &ingresses[i]
+		key := client.ObjectKeyFromObject(ingress)
+		conditions := ingressConditions(ingress)
+		if msgs := messages[key]; len(msgs) > 0 {
+			meta.SetStatusCondition(&conditions, metav1.Condition{
+				Type:               conditionHostConflict,
+				Status:             metav1.ConditionTrue,
+				Reason:             reasonHostConflict,
+				Message:            strings.Join(msgs, "; "),
+				ObservedGeneration: ingress.Generation,
+			})
+		} else {
+			meta.RemoveStatusCondition(&conditions, conditionHostConflict)
+		}
+
+		if r.hasRequiredAnnotation(ingress) {
+			r.setRewriteAppliedCondition(ingress, &conditions, rewrites[key], skips[key])
+		} else {
+			meta.RemoveStatusCondition(&conditions, conditionRewriteApplied)
+		}
+
+		if err := r.setIngressConditions(ctx, ingress, conditions); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setRewriteAppliedCondition sets the RewriteApplied condition listing the
+// rewrites of an Ingress, as "host -> target", and records a RewriteApplied
+// event when they changed. Hosts the DNS provider skipped turn the condition
+// False, with the reason of the first one.
+func (r *IngressReconciler) setRewriteAppliedCondition(ingress *networkingv1.Ingress, conditions *[]metav1.Condition, rewrites []string, skipped []skippedRule) {
+	rewritten := strings.Join(rewrites, ", ")
+	condition := metav1.Condition{
+		Type:               conditionRewriteApplied,
+		Status:             metav1.ConditionTrue,
+		Reason:             reasonRewriteApplied,
+		Message:            rewritten,
+		ObservedGeneration: ingress.Generation,
+	}
+	switch {
+	case len(skipped) > 0:
+		messages := make([]string, len(skipped))
+		for i, s := range skipped {
+			messages[i] = fmt.Sprintf("%s not rewritten: %s", s.Rule.Host, s.Message)
+		}
+		if len(rewrites) > 0 {
+			messages = append(messages, "rewritten: "+rewritten)
+		}
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = skipped[0].Reason
+		condition.Message = strings.Join(messages, "; ")
+	case len(rewrites) == 0:
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = reasonNoHostsRewritten
+		condition.Message = "No host of the Ingress is rewritten"
+	}
+
+	previous := meta.FindStatusCondition(*conditions, conditionRewriteApplied)
+	changed := previous == nil || previous.Status != condition.Status || previous.Message != condition.Message
+	meta.SetStatusCondition(conditions, condition)
+	if changed && len(rewrites) > 0 {
+		r.recordEvent(ingress, corev1.EventTypeNormal, reasonRewriteApplied, "Hosts rewritten: %s", rewritten)
+	}
+}
+
+// setIngressConditions stores conditions in the statusAnnotation of an
+// Ingress, removing the annotation when there are none. The Ingress is only
+// patched when the annotation actually changes.
+func (r *IngressReconciler) setIngressConditions(ctx context.Context, ingress *networkingv1.Ingress, conditions []metav1.Condition) error {
+	current, exists := ingress.GetAnnotations()[statusAnnotation]
+	var desired string
+	if len(conditions) > 0 {
+		raw, err := json.Marshal(conditions)
+		if err != nil {
+			return err
+		}
+		desired = string(raw)
+	}
+	if (len(conditions) == 0 && !exists) || (exists && current == desired) {
+		return nil
+	}
+
+	patch := client.MergeFrom(ingress.DeepCopy())
+	if len(conditions) == 0 {
+		delete(ingress.Annotations, statusAnnotation)
+	} else {
+		if ingress.Annotations == nil {
+			ingress.Annotations = map[string]string{}
+		}
+		ingress.Annotations[statusAnnotation] = desired
+	}
+	if err := r.Patch(ctx, ingress, patch); err != nil {
+		r.Log.Error(err, "unable to update Ingress status annotation", "ingress", client.ObjectKeyFromObject(ingress))
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// ProviderKubeDNS writes dnsmasq host overrides into the kube-dns ConfigMap.
+	ProviderKubeDNS = "kube-dns"
+
+	kubeDNSConfigMapName = "kube-dns"
+	// kubeDNSConfigKey is the dnsmasq configuration file kic owns in the kube-dns
+	// ConfigMap, next to the stubDomains and upstreamNameservers keys.
+	kubeDNSConfigKey = "kic.conf"
+	// kubeDNSConfigHashAnnotation is set on the pod template of the kube-dns
+	// Deployment to roll it out when kubeDNSConfigKey changes, since dnsmasq only
+	// reads its configuration files on start.
+	kubeDNSConfigHashAnnotation = "kic.pelo.tech/config-hash"
+
+	// reasonNoClusterIP is the reason a host whose target has no ClusterIP is skipped for.
+	reasonNoClusterIP = "NoClusterIP"
+)
+
+// kubeDNSProvider answers the records from the dnsmasq of a kube-dns
+// deployment. dnsmasq can only alias names it knows locally, so every host is
+// answered with the ClusterIPs of its target Service.
+type kubeDNSProvider struct {
+	*IngressReconciler
+}
+
+// Apply renders the records as dnsmasq configuration and writes it into the
+// kube-dns ConfigMap, creating the ConfigMap if kube-dns runs without one,
+// then rolls out kube-dns if KubeDNSRollout is set.
+func (p *kubeDNSProvider) Apply(ctx context.Context, records []rewriteRule) (Applied, error) {
+	log := p.Log.WithName("kube-dns-updater")
+
+	config, skipped, err := p.renderDnsmasqConfig(ctx, records)
+	if err != nil {
+		log.Error(err, "unable to render dnsmasq configuration")
+		return Applied{}, err
+	}
+
+	var configMap *corev1.ConfigMap
+	var drift Drift
+	err = p.retryOnConflict(func(reader client.Reader) error {
+		var err error
+		if configMap, err = p.getKubeDNSConfigMap(ctx, reader); err != nil {
+			log.Error(err, "unable to fetch kube-dns ConfigMap")
+			return err
+		}
+		drift = lineDrift(configMap.Data[kubeDNSConfigKey], config)
+		return p.updateManagedConfigMap(ctx, configMap, map[string]string{kubeDNSConfigKey: config})
+	})
+	if err != nil {
+		log.Error(err, "unable to update kube-dns ConfigMap")
+		return Applied{}, err
+	}
+	if !p.KubeDNSRollout {
+		if !drift.Empty() {
+			log.Info("dnsmasq configuration changed, it takes effect when kube-dns restarts")
+		}
+		return Applied{Skipped: skipped, Drift: drift, Rendered: config}, nil
+	}
+	if err := p.rolloutKubeDNS(ctx, configMap.Data[kubeDNSConfigKey]); err != nil {
+		log.Error(err, "unable to roll out kube-dns")
+		return Applied{}, err
+	}
+	return Applied{Skipped: skipped, Drift: drift, Rendered: config}, nil
+}
+
+// rolloutKubeDNS sets the hash of the dnsmasq configuration on the pod
+// template of the kube-dns Deployment, which rolls it out whenever the
+// configuration changes. A missing Deployment is left to whoever deploys it.
+// The Deployment is read directly rather than through a cache of every
+// Deployment of the cluster.
+func (p *kubeDNSProvider) rolloutKubeDNS(ctx context.Context, config string) error {
+	var deployment appsv1.Deployment
+	if err := p.apiReader().Get(ctx, client.ObjectKey{Namespace: coreDNSConfigMapNamespace, Name: kubeDNSConfigMapName}, &deployment); err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	hash := fmt.Sprintf("%x", sha256.Sum256([]byte(config)))
+	if deployment.Spec.Template.Annotations[kubeDNSConfigHashAnnotation] == hash {
+		return nil
+	}
+	patch := client.MergeFrom(deployment.DeepCopy())
+	if deployment.Spec.Template.Annotations == nil {
+		deployment.Spec.Template.Annotations = map[string]string{}
+	}
+	deployment.Spec.Template.Annotations[kubeDNSConfigHashAnnotation] = hash
+	return p.Patch(ctx, &deployment, patch)
+}
+
+// getKubeDNSConfigMap reads the kube-dns ConfigMap from reader, which
+// kube-dns treats as optional. A ConfigMap that does not exist yet is returned without a
+// resourceVersion, for updateManagedConfigMap to create.
+func (p *kubeDNSProvider) getKubeDNSConfigMap(ctx context.Context, reader client.Reader) (*corev1.ConfigMap, error) {
+	key := client.ObjectKey{Namespace: coreDNSConfigMapNamespace, Name: kubeDNSConfigMapName}
+	var configMap corev1.ConfigMap
+	if err := reader.Get(ctx, key, &configMap); err != nil {
+		if !errors.IsNotFound(err) {
+			return nil, err
+		}
+		return &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace}}, nil
+	}
+	return &configMap, nil
+}
+
+// renderDnsmasqConfig renders a host-record for every exact host, which only
+// answers the host itself, and an address for every wildcard, which answers the
+// wildcard's parent domain and every name below it. Hosts whose target has no
+// ClusterIP are skipped.
+func (p *kubeDNSProvider) renderDnsmasqConfig(ctx context.Context, records []rewriteRule) (string, []skippedRule, error) {
+	var config strings.Builder
+	var skipped []skippedRule
+	config.WriteString(managedConfigMapHeader)
+	for _, record := range records {
+		ips, err := p.ruleIPs(ctx, record)
+		if err != nil {
+			return "", nil, err
+		}
+		if len(ips) == 0 {
+			p.Log.Info("Target has no ClusterIP, host is not answered by kube-dns", "host", record.Host, "target", record.Target)
+			skipped = append(skipped, skippedRule{
+				Rule:    record,
+				Reason:  reasonNoClusterIP,
+				Message: fmt.Sprintf("target %s has no ClusterIP, which kube-dns needs", record.Target),
+			})
+			continue
+		}
+
+		if domain, ok := strings.CutPrefix(record.Host, "*."); ok {
+			for _, ip := range ips {
+				fmt.Fprintf(&config, "address=/%s/%s\n", domain, ip)
+			}
+			continue
+		}
+		fmt.Fprintf(&config, "host-record=%s,%s\n", record.Host, strings.Join(ips, ","))
+	}
+	return config.String(), skipped, nil
+}
@@ -0,0 +1,134 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+func TestKubeDNSProvider(t *testing.T) {
+	const nginx = "nginx.ingress.svc.cluster.local"
+	kubeDNS := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: kubeDNSConfigMapName, Namespace: coreDNSConfigMapNamespace},
+		Data:       map[string]string{"stubDomains": `{"corp.internal": ["10.0.0.10"]}`},
+	}
+	c := newFakeClient(t, kubeDNS, newService("ingress", "nginx", "10.96.0.10", "fd00::10"))
+	r := &IngressReconciler{Client: c, Log: logr.Discard(), ClusterDomain: "cluster.local", DNSProvider: ProviderKubeDNS}
+	provider, err := r.dnsProvider()
+	if err != nil {
+		t.Fatalf("dnsProvider() returned error: %v", err)
+	}
+	records := []rewriteRule{
+		{Host: "www.example.com", Target: nginx},
+		{Host: "external.example.com", Target: "gateway.example.org"},
+		{Host: "*.apps.example.com", Target: nginx},
+	}
+
+	applied, err := provider.Apply(context.Background(), records)
+	if err != nil {
+		t.Fatalf("Apply() returned error: %v", err)
+	}
+	if len(applied.Skipped) != 1 || applied.Skipped[0].Rule.Host != "external.example.com" || applied.Skipped[0].Reason != reasonNoClusterIP {
+		t.Errorf("expected the host without ClusterIP to be skipped, got %+v", applied.Skipped)
+	}
+	drift := applied.Drift
+	expected := []string{
+		"host-record=www.example.com,10.96.0.10,fd00::10",
+		"address=/apps.example.com/10.96.0.10",
+		"address=/apps.example.com/fd00::10",
+	}
+	if len(drift.Missing) == 0 || !reflect.DeepEqual(drift.Missing[1:], expected) || len(drift.Stale) != 0 {
+		t.Errorf("unexpected drift: %+v", drift)
+	}
+
+	var updated corev1.ConfigMap
+	if err := c.Get(context.Background(), client.ObjectKeyFromObject(kubeDNS), &updated); err != nil {
+		t.Fatal(err)
+	}
+	if updated.Data["stubDomains"] != kubeDNS.Data["stubDomains"] {
+		t.Errorf("expected stubDomains to be kept, got %v", updated.Data)
+	}
+	if lines := significantLines(updated.Data[kubeDNSConfigKey]); !reflect.DeepEqual(lines[1:], expected) {
+		t.Errorf("unexpected dnsmasq configuration:\n%s", updated.Data[kubeDNSConfigKey])
+	}
+}
+
+func TestKubeDNSProviderRollsOutKubeDNS(t *testing.T) {
+	kubeDNS := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: kubeDNSConfigMapName, Namespace: coreDNSConfigMapNamespace}}
+	apiReader := newFakeClientBuilder(t).WithObjects(kubeDNS, newService("ingress", "nginx", "10.96.0.10")).Build()
+	// The cached client must not be used for Deployments, which would cache every Deployment of the cluster
+	c := interceptor.NewClient(apiReader, interceptor.Funcs{
+		Get: func(ctx context.Context, c client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+			if _, ok := obj.(*appsv1.Deployment); ok {
+				return fmt.Errorf("unexpected cached read of Deployment %s", key)
+			}
+			return c.Get(ctx, key, obj, opts...)
+		},
+	})
+	provider := &kubeDNSProvider{&IngressReconciler{
+		Client:         c,
+		APIReader:      apiReader,
+		Log:            logr.Discard(),
+		ClusterDomain:  "cluster.local",
+		KubeDNSRollout: true,
+	}}
+
+	hashes := map[string]bool{}
+	for _, host := range []string{"www.example.com", "www.example.com", "api.example.com"} {
+		records := []rewriteRule{{Host: host, Target: "nginx.ingress.svc.cluster.local"}}
+		if _, err := provider.Apply(context.Background(), records); err != nil {
+			t.Fatalf("Apply() returned error: %v", err)
+		}
+		var updated appsv1.Deployment
+		if err := apiReader.Get(context.Background(), client.ObjectKeyFromObject(kubeDNS), &updated); err != nil {
+			t.Fatal(err)
+		}
+		hashes[updated.Spec.Template.Annotations[kubeDNSConfigHashAnnotation]] = true
+	}
+	if len(hashes) != 2 || hashes[""] {
+		t.Errorf("expected a new configuration hash for every configuration change, got %v", hashes)
+	}
+}
+
+func TestKubeDNSProviderWithoutRollout(t *testing.T) {
+	kubeDNS := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: kubeDNSConfigMapName, Namespace: coreDNSConfigMapNamespace}}
+	c := newFakeClient(t, kubeDNS, newService("ingress", "nginx", "10.96.0.10"))
+	provider := &kubeDNSProvider{&IngressReconciler{Client: c, Log: logr.Discard(), ClusterDomain: "cluster.local"}}
+	records := []rewriteRule{{Host: "www.example.com", Target: "nginx.ingress.svc.cluster.local"}}
+	if _, err := provider.Apply(context.Background(), records); err != nil {
+		t.Fatalf("Apply() returned error: %v", err)
+	}
+
+	var updated appsv1.Deployment
+	if err := c.Get(context.Background(), client.ObjectKeyFromObject(kubeDNS), &updated); err != nil {
+		t.Fatal(err)
+	}
+	if len(updated.Spec.Template.Annotations) != 0 {
+		t.Errorf("expected kube-dns not to be rolled out by default, got %v", updated.Spec.Template.Annotations)
+	}
+}
+
+func TestKubeDNSProviderCreatesConfigMap(t *testing.T) {
+	c := newFakeClient(t, newService("ingress", "nginx", "10.96.0.10"))
+	provider := &kubeDNSProvider{&IngressReconciler{Client: c, Log: logr.Discard(), ClusterDomain: "cluster.local"}}
+	records := []rewriteRule{{Host: "www.example.com", Target: "nginx.ingress.svc.cluster.local"}}
+	if _, err := provider.Apply(context.Background(), records); err != nil {
+		t.Fatalf("Apply() returned error: %v", err)
+	}
+
+	var created corev1.ConfigMap
+	if err := c.Get(context.Background(), client.ObjectKey{Namespace: coreDNSConfigMapNamespace, Name: kubeDNSConfigMapName}, &created); err != nil {
+		t.Fatalf("expected the kube-dns ConfigMap to be created: %v", err)
+	}
+	if expected := managedConfigMapHeader + "host-record=www.example.com,10.96.0.10\n"; created.Data[kubeDNSConfigKey] != expected {
+		t.Errorf("unexpected dnsmasq configuration:\n%s", created.Data[kubeDNSConfigKey])
+	}
+}
@@ -0,0 +1,48 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// Values of the reason label of rejectedHosts.
+const (
+	rejectReasonInvalid   = "invalid"
+	rejectReasonProtected = "protected"
+)
+
+var (
+	// rejectedHosts is the number of hosts left out of the last rule set, by reason.
+	rejectedHosts = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kic_rejected_hosts",
+		Help: "Number of hosts left out of the managed DNS rules, by reason.",
+	}, []string{"reason"})
+
+	// driftRepairs is the number of times the DNS configuration was found changed by someone else and repaired.
+	driftRepairs = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kic_dns_drift_repairs_total",
+		Help: "Number of times the DNS configuration had drifted from the applied rules and was repaired, by provider.",
+	}, []string{"provider"})
+)
+
+func init() {
+	// Register custom metrics with the global controller-runtime registry so
+	// they are served alongside the built-in controller metrics.
+	metrics.Registry.MustRegister(rejectedHosts, driftRepairs)
+}
@@ -0,0 +1,151 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/pelotech/kic/internal/corefile"
+)
+
+// nodeLocalDNSConfigMapName is the ConfigMap of NodeLocal DNSCache, whose
+// Corefile forwards everything outside the cluster domain upstream.
+const nodeLocalDNSConfigMapName = "node-local-dns"
+
+// forwardsNodeLocalDNS reports whether the zones of the rules are forwarded
+// by NodeLocal DNSCache. Records pushed to an upstream server already reach it
+// through its upstream forwarding.
+func (r *IngressReconciler) forwardsNodeLocalDNS() bool {
+	return r.NodeLocalDNS && r.providerName() != ProviderRFC2136
+}
+
+// updateNodeLocalDNS makes NodeLocal DNSCache, when it is deployed, forward
+// the zones of the rules to cluster DNS, which answers them. Otherwise pods
+// on nodes running the cache would resolve Ingress hosts upstream.
+func (r *IngressReconciler) updateNodeLocalDNS(ctx context.Context, rules []rewriteRule) error {
+	return r.retryOnConflict(func(reader client.Reader) error {
+		return r.applyNodeLocalDNS(ctx, reader, rules)
+	})
+}
+
+// applyNodeLocalDNS reads the node-local-dns ConfigMap from reader, forwards
+// the zones of the rules in its Corefile and writes it back.
+func (r *IngressReconciler) applyNodeLocalDNS(ctx context.Context, reader client.Reader, rules []rewriteRule) error {
+	log := r.Log.WithName("node-local-dns-updater")
+
+	var configMap corev1.ConfigMap
+	if err := reader.Get(ctx, client.ObjectKey{Namespace: coreDNSConfigMapNamespace, Name: nodeLocalDNSConfigMapName}, &configMap); err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		log.Error(err, "unable to fetch node-local-dns ConfigMap")
+		return err
+	}
+
+	original := configMap.Data[corefileKey]
+	updated, err := r.forwardZonesToClusterDNS(original, rules)
+	if err != nil {
+		log.Error(err, "unable to forward Ingress zones in the node-local-dns Corefile")
+		return err
+	}
+	if corefilesEquivalent(original, updated) {
+		return nil
+	}
+
+	configMap.Data[corefileKey] = updated
+	if err := r.writeConfigMap(ctx, &configMap, corefileKey); err != nil {
+		log.Error(err, "unable to update node-local-dns ConfigMap")
+		return err
+	}
+	log.Info("Successfully updated node-local-dns ConfigMap with the Ingress zones")
+	return nil
+}
+
+// forwardZonesToClusterDNS puts a managed server block in a NodeLocal
+// DNSCache Corefile that serves the zones of the rules exactly like the
+// cluster domain, which the cache forwards to cluster DNS. The health plugin,
+// which can only listen once, is left out.
+func (r *IngressReconciler) forwardZonesToClusterDNS(corefileContent string, rules []rewriteRule) (string, error) {
+	parsed, err := corefile.Parse(corefileContent)
+	if err != nil {
+		return "", fmt.Errorf("unable to parse Corefile: %w", err)
+	}
+
+	var managed []*corefile.Node
+	if zones := ruleZones(rules); len(zones) > 0 {
+		clusterKey := corefile.ParseServerKey(r.ClusterDomain)
+		clusterBlock := parsed.ServerBlock(clusterKey)
+		if clusterBlock == nil {
+			return "", fmt.Errorf("no server block for the cluster domain %s", clusterKey)
+		}
+
+		block := clusterBlock.Clone()
+		block.Detach()
+		keys := make([]string, len(zones))
+		for i, zone := range zones {
+			keys[i] = corefile.ServerKey{Scheme: clusterKey.Scheme, Zone: zone, Port: clusterKey.Port}.String()
+		}
+		block.Name, block.Args, block.Comment = keys[0], keys[1:], ""
+		block.Block = slices.DeleteFunc(block.Block, func(n *corefile.Node) bool { return n.Name == "health" })
+
+		managed = []*corefile.Node{
+			corefile.NewComment(managedRulesBeginMarker),
+			block,
+			corefile.NewComment(managedRulesEndMarker),
+		}
+	}
+
+	nodes, found, err := replaceManagedRegion(parsed.Nodes, managed)
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		nodes = append(nodes, managed...)
+	}
+	parsed.Nodes = nodes
+	return printCorefile(parsed), nil
+}
+
+// ruleZones returns the zones covering the hosts of the rules: the host
+// itself, or the parent domain of a wildcard. Zones below another one are
+// left out.
+func ruleZones(rules []rewriteRule) []string {
+	var zones []string
+	for _, rule := range rules {
+		zone := strings.ToLower(strings.TrimPrefix(rule.Host, "*.")) + "."
+		zones = append(zones, zone)
+	}
+	slices.SortFunc(zones, func(a, b string) int { return len(a) - len(b) })
+
+	var covering []string
+	for _, zone := range zones {
+		if !slices.ContainsFunc(covering, func(parent string) bool {
+			return zone == parent || strings.HasSuffix(zone, "."+parent)
+		}) {
+			covering = append(covering, zone)
+		}
+	}
+	slices.Sort(covering)
+	return covering
+}
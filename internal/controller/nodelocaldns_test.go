@@ -0,0 +1,116 @@
+package controller
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// nodeLocalDNSCorefile is an excerpt of the Corefile NodeLocal DNSCache ships with.
+const nodeLocalDNSCorefile = `cluster.local:53 {
+    errors
+    cache {
+            success 9984 30
+            denial 9984 5
+    }
+    reload
+    loop
+    bind 169.254.20.10 10.96.0.10
+    forward . __PILLAR__CLUSTER__DNS__ {
+            force_tcp
+    }
+    prometheus :9253
+    health 169.254.20.10:8080
+    }
+.:53 {
+    errors
+    cache 30
+    reload
+    loop
+    bind 169.254.20.10 10.96.0.10
+    forward . __PILLAR__UPSTREAM__SERVERS__
+    prometheus :9253
+    }
+`
+
+func TestRuleZones(t *testing.T) {
+	rules := []rewriteRule{
+		{Host: "www.example.com"},
+		{Host: "a.b.apps.example.com"},
+		{Host: "*.apps.example.com"},
+		{Host: "API.example.org"},
+		{Host: "*.example.org", SuffixMatch: true},
+	}
+	expected := []string{"apps.example.com.", "example.org.", "www.example.com."}
+	if actual := ruleZones(rules); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("ruleZones() = %v, expected %v", actual, expected)
+	}
+}
+
+func TestUpdateNodeLocalDNS(t *testing.T) {
+	const target = "ingress-nginx-controller.ingress-nginx.svc.cluster.local"
+	web := newIngress("apps", "web", "www.example.com", "*.apps.example.com")
+	coreDNS := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: coreDNSConfigMapName, Namespace: coreDNSConfigMapNamespace},
+		Data:       map[string]string{corefileKey: ".:53 {\n    kubernetes cluster.local\n}\n"},
+	}
+	nodeLocalDNS := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: nodeLocalDNSConfigMapName, Namespace: coreDNSConfigMapNamespace},
+		Data:       map[string]string{corefileKey: nodeLocalDNSCorefile},
+	}
+	c := newFakeClient(t, &web, coreDNS, nodeLocalDNS)
+	r := &IngressReconciler{
+		Client:                       c,
+		Log:                          logr.Discard(),
+		IngressControllerServiceName: target,
+		ClusterDomain:                "cluster.local",
+		NodeLocalDNS:                 true,
+	}
+	if err := r.updateDNS(context.Background()); err != nil {
+		t.Fatalf("updateDNS() returned error: %v", err)
+	}
+
+	var updated corev1.ConfigMap
+	if err := c.Get(context.Background(), client.ObjectKeyFromObject(nodeLocalDNS), &updated); err != nil {
+		t.Fatal(err)
+	}
+	expected := nodeLocalDNSCorefile +
+		managedRulesBeginMarker + "\n" +
+		"apps.example.com.:53 www.example.com.:53 {\n" +
+		"    errors\n" +
+		"    cache {\n" +
+		"        success 9984 30\n" +
+		"        denial 9984 5\n" +
+		"    }\n" +
+		"    reload\n" +
+		"    loop\n" +
+		"    bind 169.254.20.10 10.96.0.10\n" +
+		"    forward . __PILLAR__CLUSTER__DNS__ {\n" +
+		"        force_tcp\n" +
+		"    }\n" +
+		"    prometheus :9253\n" +
+		"}\n" +
+		managedRulesEndMarker + "\n"
+	if updated.Data[corefileKey] != expected {
+		t.Errorf("unexpected node-local-dns Corefile:\nExpected:\n%s\nActual:\n%s", expected, updated.Data[corefileKey])
+	}
+
+	// Without hosts, the managed server block is removed again.
+	if err := c.Delete(context.Background(), &web); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.updateDNS(context.Background()); err != nil {
+		t.Fatalf("updateDNS() returned error: %v", err)
+	}
+	if err := c.Get(context.Background(), client.ObjectKeyFromObject(nodeLocalDNS), &updated); err != nil {
+		t.Fatal(err)
+	}
+	if !corefilesEquivalent(updated.Data[corefileKey], nodeLocalDNSCorefile) {
+		t.Errorf("expected the managed server block to be removed:\n%s", updated.Data[corefileKey])
+	}
+}
@@ -0,0 +1,180 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ProviderCoreDNS manages the records in the CoreDNS Corefile. It is the default provider.
+const ProviderCoreDNS = "coredns"
+
+// DNSProvider makes a cluster DNS server resolve the hosts collected by the
+// reconcilers. Implementations own everything specific to their DNS server;
+// the reconcile loop only computes the desired records and hands them over.
+type DNSProvider interface {
+	// Apply makes the DNS server resolve exactly the given records, which are
+	// valid, free of conflicts and in canonical order. It reports the records
+	// the server could not be configured with, and how what the server was
+	// configured with beforehand drifted from the records.
+	Apply(ctx context.Context, records []rewriteRule) (Applied, error)
+}
+
+// Applied is what a provider made of the records it was given.
+type Applied struct {
+	// Skipped are the records the DNS server was not configured with.
+	Skipped []skippedRule
+	// Drift is how the configuration of the DNS server differed from the
+	// records it was configured with.
+	Drift Drift
+	// Rendered is the configuration the records were rendered into, in the
+	// provider's own terms. It only changes with the records and what they
+	// resolve to, such as the ClusterIPs of their targets.
+	Rendered string
+}
+
+// skippedRule is a record a provider left out of the DNS server.
+type skippedRule struct {
+	Rule rewriteRule
+	// Reason is a CamelCase reason, such as NoClusterIP.
+	Reason string
+	// Message tells why the record was left out.
+	Message string
+}
+
+// appliedRules returns the records the DNS server was configured with: the
+// given records, but the skipped ones.
+func (a Applied) appliedRules(records []rewriteRule) []rewriteRule {
+	if len(a.Skipped) == 0 {
+		return records
+	}
+	skipped := make(map[string]bool, len(a.Skipped))
+	for _, s := range a.Skipped {
+		skipped[s.Rule.Host] = true
+	}
+	applied := make([]rewriteRule, 0, len(records))
+	for _, record := range records {
+		if !skipped[record.Host] {
+			applied = append(applied, record)
+		}
+	}
+	return applied
+}
+
+// Drift describes how the configuration of a DNS server differed from the
+// desired records, in the provider's own terms, such as Corefile lines.
+type Drift struct {
+	// Missing entries were desired but not configured.
+	Missing []string
+	// Stale entries were configured but not desired.
+	Stale []string
+}
+
+// Empty reports whether the DNS server was already up to date.
+func (d Drift) Empty() bool {
+	return len(d.Missing) == 0 && len(d.Stale) == 0
+}
+
+// providerName is the name of the configured DNSProvider, ProviderCoreDNS by default.
+func (r *IngressReconciler) providerName() string {
+	if r.DNSProvider == "" {
+		return ProviderCoreDNS
+	}
+	return r.DNSProvider
+}
+
+// dnsProviders builds the provider of every --dns-provider name from the
+// reconciler's configuration.
+var dnsProviders = map[string]func(r *IngressReconciler) (DNSProvider, error){
+	ProviderCoreDNS: func(r *IngressReconciler) (DNSProvider, error) { return &coreDNSProvider{r}, nil },
+	ProviderKubeDNS: func(r *IngressReconciler) (DNSProvider, error) {
+		if len(r.CoreDNSExcludedNamespaces) > 0 {
+			return nil, fmt.Errorf("excluded namespaces are not supported by kube-dns")
+		}
+		return &kubeDNSProvider{r}, nil
+	},
+	ProviderEmbedded: newEmbeddedProvider,
+	ProviderRFC2136:  newRFC2136Provider,
+}
+
+// DNSProviders returns the names of the available providers.
+func DNSProviders() []string {
+	names := make([]string, 0, len(dnsProviders))
+	for name := range dnsProviders {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// dnsProvider returns the provider selected by DNSProvider, building it on
+// first use so that stateful providers keep their state across reconciles.
+func (r *IngressReconciler) dnsProvider() (DNSProvider, error) {
+	if r.provider != nil {
+		return r.provider, nil
+	}
+	name := r.providerName()
+	newProvider, ok := dnsProviders[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown DNS provider %q, expected one of %s", name, strings.Join(DNSProviders(), ", "))
+	}
+	provider, err := newProvider(r)
+	if err != nil {
+		return nil, fmt.Errorf("unable to set up DNS provider %q: %w", name, err)
+	}
+	r.provider = provider
+	return provider, nil
+}
+
+// lineDrift compares configured and desired configuration files line by line,
+// ignoring indentation and blank lines.
+func lineDrift(configured, desired string) Drift {
+	remaining := map[string]int{}
+	for _, line := range significantLines(configured) {
+		remaining[line]++
+	}
+	var drift Drift
+	for _, line := range significantLines(desired) {
+		if remaining[line] > 0 {
+			remaining[line]--
+			continue
+		}
+		drift.Missing = append(drift.Missing, line)
+	}
+	for _, line := range significantLines(configured) {
+		if remaining[line] > 0 {
+			remaining[line]--
+			drift.Stale = append(drift.Stale, line)
+		}
+	}
+	return drift
+}
+
+// resolvesClusterIPs reports whether the provider answers hosts with the
+// ClusterIPs of their target Service, which must then be watched.
+func (r *IngressReconciler) resolvesClusterIPs() bool {
+	switch r.DNSProvider {
+	case "", ProviderCoreDNS:
+		return r.Backend == BackendHosts || r.Backend == BackendFile
+	case ProviderKubeDNS, ProviderEmbedded, ProviderRFC2136:
+		return true
+	}
+	return false
+}
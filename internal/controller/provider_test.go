@@ -0,0 +1,143 @@
+package controller
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// recordingProvider is a DNSProvider that keeps the records it was given,
+// and skips those of the hosts listed in skip.
+type recordingProvider struct {
+	records []rewriteRule
+	skip    []string
+}
+
+func (p *recordingProvider) Apply(_ context.Context, records []rewriteRule) (Applied, error) {
+	p.records = withoutSources(records)
+	var applied Applied
+	for _, record := range records {
+		if slices.Contains(p.skip, record.Host) {
+			applied.Skipped = append(applied.Skipped, skippedRule{Rule: record, Reason: reasonNoClusterIP, Message: "no ClusterIP"})
+		}
+	}
+	return applied, nil
+}
+
+func TestUpdateDNSAppliesRecordsToProvider(t *testing.T) {
+	const target = "ingress-nginx-controller.ingress-nginx.svc.cluster.local"
+	web := newIngress("apps", "web", "www.example.com", "*.apps.example.com", "api.example.com")
+	provider := &recordingProvider{}
+	r := &IngressReconciler{
+		Client:                       newFakeClient(t, &web),
+		Log:                          logr.Discard(),
+		IngressControllerServiceName: target,
+		provider:                     provider,
+	}
+	if err := r.updateDNS(context.Background()); err != nil {
+		t.Fatalf("updateDNS() returned error: %v", err)
+	}
+
+	expected := []rewriteRule{
+		{Host: "api.example.com", Target: target},
+		{Host: "www.example.com", Target: target},
+		{Host: "*.apps.example.com", Target: target},
+	}
+	if !reflect.DeepEqual(provider.records, expected) {
+		t.Errorf("unexpected records:\nExpected: %v\nActual:   %v", expected, provider.records)
+	}
+}
+
+func TestUpdateDNSReportsSkippedHosts(t *testing.T) {
+	const target = "ingress-nginx-controller.ingress-nginx.svc.cluster.local"
+	web := newIngress("apps", "web", "www.example.com", "api.example.com")
+	recorder := record.NewFakeRecorder(10)
+	c := newFakeClient(t, &web)
+	r := &IngressReconciler{
+		Client:                       c,
+		Log:                          logr.Discard(),
+		Recorder:                     recorder,
+		IngressControllerServiceName: target,
+		provider:                     &recordingProvider{skip: []string{"api.example.com"}},
+	}
+	if err := r.updateDNS(context.Background()); err != nil {
+		t.Fatalf("updateDNS() returned error: %v", err)
+	}
+
+	var ingress networkingv1.Ingress
+	if err := c.Get(context.Background(), client.ObjectKeyFromObject(&web), &ingress); err != nil {
+		t.Fatal(err)
+	}
+	condition := meta.FindStatusCondition(ingressConditions(&ingress), conditionRewriteApplied)
+	expectedMessage := "api.example.com not rewritten: no ClusterIP; rewritten: www.example.com -> " + target
+	if condition == nil || condition.Status != metav1.ConditionFalse || condition.Reason != reasonNoClusterIP || condition.Message != expectedMessage {
+		t.Errorf("expected the skipped host in a False condition with message %q, got %+v", expectedMessage, condition)
+	}
+	expectedEvent := "Normal " + reasonRewriteApplied + " Hosts rewritten: www.example.com -> " + target
+	if event := <-recorder.Events; event != expectedEvent {
+		t.Errorf("unexpected event %q, expected %q", event, expectedEvent)
+	}
+}
+
+func TestDNSProvider(t *testing.T) {
+	r := &IngressReconciler{}
+	provider, err := r.dnsProvider()
+	if err != nil {
+		t.Fatalf("dnsProvider() returned error: %v", err)
+	}
+	if _, ok := provider.(*coreDNSProvider); !ok {
+		t.Errorf("expected the CoreDNS provider by default, got %T", provider)
+	}
+
+	r = &IngressReconciler{DNSProvider: "bind"}
+	if _, err := r.dnsProvider(); err == nil || !strings.Contains(err.Error(), ProviderCoreDNS) {
+		t.Errorf("expected an error listing the available providers, got %v", err)
+	}
+}
+
+func TestCoreDNSProviderDrift(t *testing.T) {
+	const target = "ingress-nginx-controller.ingress-nginx.svc.cluster.local"
+	coreDNS := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: coreDNSConfigMapName, Namespace: coreDNSConfigMapNamespace},
+		Data: map[string]string{corefileKey: ".:53 {\n" +
+			"    kubernetes cluster.local\n" +
+			"    " + managedRulesBeginMarker + "\n" +
+			"    rewrite name old.example.com " + target + "\n" +
+			"    rewrite name www.example.com " + target + "\n" +
+			"    " + managedRulesEndMarker + "\n" +
+			"}\n"},
+	}
+	r := &IngressReconciler{Client: newFakeClient(t, coreDNS), Log: logr.Discard()}
+	provider := &coreDNSProvider{r}
+	records := []rewriteRule{
+		{Host: "api.example.com", Target: target},
+		{Host: "www.example.com", Target: target},
+	}
+
+	applied, err := provider.Apply(context.Background(), records)
+	if err != nil {
+		t.Fatalf("Apply() returned error: %v", err)
+	}
+	drift := applied.Drift
+	expected := Drift{
+		Missing: []string{"rewrite name api.example.com " + target},
+		Stale:   []string{"rewrite name old.example.com " + target},
+	}
+	if !reflect.DeepEqual(drift, expected) {
+		t.Errorf("unexpected drift:\nExpected: %+v\nActual:   %+v", expected, drift)
+	}
+
+	if applied, err = provider.Apply(context.Background(), records); err != nil || !applied.Drift.Empty() {
+		t.Errorf("expected no drift once applied, got %+v, %v", applied.Drift, err)
+	}
+}
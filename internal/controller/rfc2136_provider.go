@@ -0,0 +1,338 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// ProviderRFC2136 pushes the records to an authoritative DNS server as RFC 2136 dynamic updates.
+	ProviderRFC2136 = "rfc2136"
+
+	// rfc2136TTL is the TTL of the records kic adds.
+	rfc2136TTL = 30
+	// rfc2136RegistryLabel names the TXT RRset, at the apex of the zone, listing
+	// the names kic owns. Records of other names are never touched.
+	rfc2136RegistryLabel = "_kic"
+
+	// Keys of the TSIG Secret.
+	tsigKeyNameKey   = "name"
+	tsigAlgorithmKey = "algorithm"
+	tsigSecretKey    = "secret"
+
+	// Reasons hosts are skipped for.
+	reasonOutsideZone   = "OutsideZone"
+	reasonZoneApexAlias = "ZoneApexAlias"
+	reasonNameNotOwned  = "NameNotOwned"
+)
+
+// rfc2136Provider keeps the records of the zone on an authoritative DNS
+// server, such as BIND, with TSIG-signed dynamic updates. The records it owns
+// are read back with a zone transfer, so it removes them even across restarts.
+type rfc2136Provider struct {
+	*IngressReconciler
+	zone string
+}
+
+func newRFC2136Provider(r *IngressReconciler) (DNSProvider, error) {
+	if r.RFC2136Server == "" || r.RFC2136Zone == "" {
+		return nil, fmt.Errorf("the server and zone are required")
+	}
+	if len(r.CoreDNSExcludedNamespaces) > 0 {
+		return nil, fmt.Errorf("excluded namespaces are not supported by RFC 2136 updates")
+	}
+	return &rfc2136Provider{IngressReconciler: r, zone: strings.ToLower(dns.Fqdn(r.RFC2136Zone))}, nil
+}
+
+// tsig holds the TSIG key signing the messages, read from a Secret.
+type tsig struct {
+	name      string
+	algorithm string
+	secret    string
+}
+
+// sign signs a message with the key, if any.
+func (t *tsig) sign(m *dns.Msg) {
+	if t != nil {
+		m.SetTsig(t.name, t.algorithm, 300, time.Now().Unix())
+	}
+}
+
+func (t *tsig) secrets() map[string]string {
+	if t == nil {
+		return nil
+	}
+	return map[string]string{t.name: t.secret}
+}
+
+// Apply transfers the zone to find the records kic owns and sends a single
+// update adding, replacing and removing records to match the desired ones.
+func (p *rfc2136Provider) Apply(ctx context.Context, records []rewriteRule) (Applied, error) {
+	log := p.Log.WithName("rfc2136-updater").WithValues("zone", p.zone, "server", p.RFC2136Server)
+
+	key, err := p.tsigKey(ctx)
+	if err != nil {
+		log.Error(err, "unable to read the TSIG key", "secret", p.RFC2136TSIGSecret)
+		return Applied{}, err
+	}
+	zone, err := p.transfer(key)
+	if err != nil {
+		log.Error(err, "unable to transfer the zone")
+		return Applied{}, err
+	}
+
+	registry := dns.Fqdn(rfc2136RegistryLabel + "." + p.zone)
+	owned := map[string]bool{}
+	for _, rr := range zone[registry] {
+		if txt, ok := rr.(*dns.TXT); ok {
+			for _, name := range txt.Txt {
+				owned[strings.ToLower(dns.Fqdn(name))] = true
+			}
+		}
+	}
+
+	desired, skipped, err := p.desiredRRs(ctx, records)
+	if err != nil {
+		return Applied{}, err
+	}
+	current := map[string][]dns.RR{}
+	for name := range owned {
+		current[name] = managedRRs(zone[name])
+	}
+
+	update := new(dns.Msg)
+	update.SetUpdate(p.zone)
+	var configured, wanted []string
+	notOwned := map[string]bool{}
+	for name, rrs := range desired {
+		if !owned[name] && len(managedRRs(zone[name])) > 0 {
+			log.Info("Name already has records not owned by kic, leaving it alone", "name", name)
+			delete(desired, name)
+			notOwned[name] = true
+			continue
+		}
+		wanted = append(wanted, rrLines(rrs)...)
+		if !owned[name] {
+			update.Insert([]dns.RR{registryRR(registry, name)})
+		}
+		if !sameRRs(current[name], rrs) {
+			if len(current[name]) > 0 {
+				update.RemoveRRset(current[name])
+			}
+			update.Insert(rrs)
+		}
+	}
+	for name := range owned {
+		configured = append(configured, rrLines(current[name])...)
+		if _, ok := desired[name]; ok {
+			continue
+		}
+		if len(current[name]) > 0 {
+			update.RemoveRRset(current[name])
+		}
+		update.Remove([]dns.RR{registryRR(registry, name)})
+	}
+	slices.Sort(configured)
+	slices.Sort(wanted)
+	rendered := strings.Join(wanted, "\n")
+	drift := lineDrift(strings.Join(configured, "\n"), rendered)
+	for _, record := range records {
+		if notOwned[strings.ToLower(dns.Fqdn(record.Host))] {
+			skipped = append(skipped, skippedRule{
+				Rule:    record,
+				Reason:  reasonNameNotOwned,
+				Message: "the name already has records kic does not own",
+			})
+		}
+	}
+	applied := Applied{Skipped: skipped, Drift: drift, Rendered: rendered}
+
+	if len(update.Ns) == 0 {
+		log.V(1).Info("DNS records are already up to date")
+		return applied, nil
+	}
+	if err := p.exchange(update, key); err != nil {
+		log.Error(err, "unable to update the zone")
+		return Applied{}, err
+	}
+	log.Info("Successfully updated the zone", "changes", len(update.Ns))
+	return applied, nil
+}
+
+// tsigKey reads the TSIG key from RFC2136TSIGSecret, given as namespace/name.
+// Messages are not signed when it is empty.
+func (p *rfc2136Provider) tsigKey(ctx context.Context) (*tsig, error) {
+	if p.RFC2136TSIGSecret == "" {
+		return nil, nil
+	}
+	namespace, name, ok := strings.Cut(p.RFC2136TSIGSecret, "/")
+	if !ok {
+		return nil, fmt.Errorf("invalid TSIG Secret %q, expected namespace/name", p.RFC2136TSIGSecret)
+	}
+
+	var secret corev1.Secret
+	if err := p.apiReader().Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, &secret); err != nil {
+		return nil, err
+	}
+	key := &tsig{
+		name:      dns.Fqdn(string(secret.Data[tsigKeyNameKey])),
+		algorithm: dns.Fqdn(string(secret.Data[tsigAlgorithmKey])),
+		secret:    string(secret.Data[tsigSecretKey]),
+	}
+	if key.algorithm == "." {
+		key.algorithm = dns.HmacSHA256
+	}
+	if key.name == "." || key.secret == "" {
+		return nil, fmt.Errorf("TSIG Secret %q needs the %q and %q keys", p.RFC2136TSIGSecret, tsigKeyNameKey, tsigSecretKey)
+	}
+	return key, nil
+}
+
+// transfer returns the records of the zone by name.
+func (p *rfc2136Provider) transfer(key *tsig) (map[string][]dns.RR, error) {
+	m := new(dns.Msg)
+	m.SetAxfr(p.zone)
+	key.sign(m)
+	t := &dns.Transfer{TsigSecret: key.secrets()}
+	envelopes, err := t.In(m, p.RFC2136Server)
+	if err != nil {
+		return nil, err
+	}
+
+	zone := map[string][]dns.RR{}
+	for envelope := range envelopes {
+		if envelope.Error != nil {
+			return nil, envelope.Error
+		}
+		for _, rr := range envelope.RR {
+			name := strings.ToLower(rr.Header().Name)
+			zone[name] = append(zone[name], rr)
+		}
+	}
+	return zone, nil
+}
+
+// exchange sends an update and checks that the server applied it.
+func (p *rfc2136Provider) exchange(update *dns.Msg, key *tsig) error {
+	key.sign(update)
+	c := &dns.Client{Net: "tcp", TsigSecret: key.secrets()}
+	resp, _, err := c.Exchange(update, p.RFC2136Server)
+	if err != nil {
+		return err
+	}
+	if resp.Rcode != dns.RcodeSuccess {
+		return fmt.Errorf("update refused with %s", dns.RcodeToString[resp.Rcode])
+	}
+	return nil
+}
+
+// desiredRRs returns the records of every host of the zone: A and AAAA
+// records with the ClusterIPs of its target Service, or a CNAME to the target.
+// Hosts outside the zone, and the apex without ClusterIPs, are skipped.
+func (p *rfc2136Provider) desiredRRs(ctx context.Context, records []rewriteRule) (map[string][]dns.RR, []skippedRule, error) {
+	desired := map[string][]dns.RR{}
+	var skipped []skippedRule
+	for _, record := range records {
+		name := strings.ToLower(dns.Fqdn(record.Host))
+		if !dns.IsSubDomain(p.zone, name) {
+			p.Log.V(1).Info("Host is outside the zone, skipping", "host", record.Host, "zone", p.zone)
+			skipped = append(skipped, skippedRule{
+				Rule:    record,
+				Reason:  reasonOutsideZone,
+				Message: fmt.Sprintf("the host is outside the zone %s", p.zone),
+			})
+			continue
+		}
+
+		ips, err := p.ruleIPs(ctx, record)
+		if err != nil {
+			return nil, nil, err
+		}
+		header := func(rrtype uint16) dns.RR_Header {
+			return dns.RR_Header{Name: name, Rrtype: rrtype, Class: dns.ClassINET, Ttl: rfc2136TTL}
+		}
+		var rrs []dns.RR
+		for _, ip := range ips {
+			if parsed := net.ParseIP(ip); parsed.To4() != nil {
+				rrs = append(rrs, &dns.A{Hdr: header(dns.TypeA), A: parsed.To4()})
+			} else {
+				rrs = append(rrs, &dns.AAAA{Hdr: header(dns.TypeAAAA), AAAA: parsed})
+			}
+		}
+		if len(rrs) == 0 {
+			if name == p.zone {
+				p.Log.Info("The zone apex cannot be an alias, skipping", "host", record.Host, "target", record.Target)
+				skipped = append(skipped, skippedRule{
+					Rule:    record,
+					Reason:  reasonZoneApexAlias,
+					Message: fmt.Sprintf("the zone apex cannot be an alias of %s, which has no ClusterIP", record.Target),
+				})
+				continue
+			}
+			rrs = append(rrs, &dns.CNAME{Hdr: header(dns.TypeCNAME), Target: dns.Fqdn(record.Target)})
+		}
+		desired[name] = rrs
+	}
+	return desired, skipped, nil
+}
+
+// managedRRs returns the records of the types kic manages.
+func managedRRs(rrs []dns.RR) []dns.RR {
+	var managed []dns.RR
+	for _, rr := range rrs {
+		switch rr.Header().Rrtype {
+		case dns.TypeA, dns.TypeAAAA, dns.TypeCNAME:
+			managed = append(managed, rr)
+		}
+	}
+	return managed
+}
+
+// registryRR is the registry record of a name kic owns.
+func registryRR(registry, name string) dns.RR {
+	return &dns.TXT{
+		Hdr: dns.RR_Header{Name: registry, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: rfc2136TTL},
+		Txt: []string{name},
+	}
+}
+
+// sameRRs reports whether two RRsets hold the same records, TTLs included.
+func sameRRs(a, b []dns.RR) bool {
+	linesA, linesB := rrLines(a), rrLines(b)
+	slices.Sort(linesA)
+	slices.Sort(linesB)
+	return slices.Equal(linesA, linesB)
+}
+
+// rrLines formats records in the zone file format, one per entry.
+func rrLines(rrs []dns.RR) []string {
+	lines := make([]string, len(rrs))
+	for i, rr := range rrs {
+		lines[i] = strings.ReplaceAll(rr.String(), "\t", " ")
+	}
+	return lines
+}
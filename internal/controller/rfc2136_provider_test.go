@@ -0,0 +1,224 @@
+package controller
+
+import (
+	"context"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/miekg/dns"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	testTSIGName   = "kic."
+	testTSIGSecret = "c2VjcmV0LXNoYXJlZC13aXRoLWJpbmQ="
+)
+
+// testZone is a minimal authoritative server for a single zone, accepting
+// TSIG-signed zone transfers and dynamic updates.
+type testZone struct {
+	mu      sync.Mutex
+	origin  string
+	rrs     []dns.RR
+	updates int
+}
+
+func (z *testZone) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	resp := new(dns.Msg).SetReply(req)
+	if w.TsigStatus() != nil || req.IsTsig() == nil {
+		resp.Rcode = dns.RcodeRefused
+		_ = w.WriteMsg(resp)
+		return
+	}
+	tsig := req.IsTsig()
+	resp.SetTsig(tsig.Hdr.Name, tsig.Algorithm, 300, time.Now().Unix())
+
+	switch {
+	case req.Opcode == dns.OpcodeUpdate:
+		z.updates++
+		for _, rr := range req.Ns {
+			h := rr.Header()
+			switch h.Class {
+			case dns.ClassANY:
+				z.rrs = slices.DeleteFunc(z.rrs, func(existing dns.RR) bool {
+					return strings.EqualFold(existing.Header().Name, h.Name) && existing.Header().Rrtype == h.Rrtype
+				})
+			case dns.ClassNONE:
+				z.rrs = slices.DeleteFunc(z.rrs, func(existing dns.RR) bool {
+					copied := dns.Copy(rr)
+					copied.Header().Class, copied.Header().Ttl = dns.ClassINET, existing.Header().Ttl
+					return dns.IsDuplicate(existing, copied)
+				})
+			default:
+				z.rrs = append(z.rrs, dns.Copy(rr))
+			}
+		}
+		_ = w.WriteMsg(resp)
+	case len(req.Question) == 1 && req.Question[0].Qtype == dns.TypeAXFR:
+		soa, _ := dns.NewRR(z.origin + " 30 IN SOA ns." + z.origin + " hostmaster." + z.origin + " 1 7200 1800 86400 30")
+		ch := make(chan *dns.Envelope, 1)
+		ch <- &dns.Envelope{RR: append(append([]dns.RR{soa}, z.rrs...), soa)}
+		close(ch)
+		_ = (&dns.Transfer{TsigSecret: map[string]string{testTSIGName: testTSIGSecret}}).Out(w, req, ch)
+	default:
+		resp.Rcode = dns.RcodeNotImplemented
+		_ = w.WriteMsg(resp)
+	}
+}
+
+// lines returns the records of the zone, sorted.
+func (z *testZone) lines() []string {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	lines := rrLines(z.rrs)
+	slices.Sort(lines)
+	return lines
+}
+
+// startTestZone serves a zone over TCP and returns it with its address.
+func startTestZone(t *testing.T, origin string, records ...string) (*testZone, string) {
+	t.Helper()
+	zone := &testZone{origin: origin}
+	for _, record := range records {
+		rr, err := dns.NewRR(record)
+		if err != nil {
+			t.Fatal(err)
+		}
+		zone.rrs = append(zone.rrs, rr)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &dns.Server{
+		Listener:   listener,
+		Handler:    zone,
+		TsigSecret: map[string]string{testTSIGName: testTSIGSecret},
+		// The default accept function refuses updates.
+		MsgAcceptFunc: func(dns.Header) dns.MsgAcceptAction { return dns.MsgAccept },
+	}
+	go func() { _ = server.ActivateAndServe() }()
+	t.Cleanup(func() { _ = server.Shutdown() })
+	return zone, listener.Addr().String()
+}
+
+func TestRFC2136Provider(t *testing.T) {
+	const nginx = "nginx.ingress.svc.cluster.local"
+	zone, addr := startTestZone(t, "example.com.",
+		"mail.example.com. 300 IN A 192.0.2.25",
+		"_kic.example.com. 30 IN TXT old.example.com.",
+		"old.example.com. 30 IN A 10.96.0.99",
+	)
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "kic", Name: "tsig"},
+		Data: map[string][]byte{
+			tsigKeyNameKey: []byte("kic"),
+			tsigSecretKey:  []byte(testTSIGSecret),
+		},
+	}
+	r := &IngressReconciler{
+		Client:            newFakeClient(t, secret, newService("ingress", "nginx", "10.96.0.10", "fd00::10")),
+		Log:               logr.Discard(),
+		ClusterDomain:     "cluster.local",
+		DNSProvider:       ProviderRFC2136,
+		RFC2136Server:     addr,
+		RFC2136Zone:       "Example.com",
+		RFC2136TSIGSecret: "kic/tsig",
+	}
+	provider, err := r.dnsProvider()
+	if err != nil {
+		t.Fatalf("dnsProvider() returned error: %v", err)
+	}
+
+	records := []rewriteRule{
+		{Host: "mail.example.com", Target: nginx},
+		{Host: "www.example.com", Target: nginx},
+		{Host: "external.example.com", Target: "gateway.example.org"},
+		{Host: "other.example.org", Target: nginx},
+		{Host: "*.apps.example.com", Target: nginx},
+		{Host: "example.com", Target: "gateway.example.org"},
+	}
+	applied, err := provider.Apply(context.Background(), records)
+	if err != nil {
+		t.Fatalf("Apply() returned error: %v", err)
+	}
+	drift := applied.Drift
+	var skipped []string
+	for _, s := range applied.Skipped {
+		skipped = append(skipped, s.Rule.Host+" "+s.Reason)
+	}
+	slices.Sort(skipped)
+	expectedSkipped := []string{
+		"example.com " + reasonZoneApexAlias,
+		"mail.example.com " + reasonNameNotOwned,
+		"other.example.org " + reasonOutsideZone,
+	}
+	if !slices.Equal(skipped, expectedSkipped) {
+		t.Errorf("unexpected skipped hosts:\nExpected: %v\nActual:   %v", expectedSkipped, skipped)
+	}
+	if len(drift.Missing) != 5 || !slices.Equal(drift.Stale, []string{"old.example.com. 30 IN A 10.96.0.99"}) {
+		t.Errorf("unexpected drift: %+v", drift)
+	}
+
+	expected := []string{
+		"*.apps.example.com. 30 IN A 10.96.0.10",
+		"*.apps.example.com. 30 IN AAAA fd00::10",
+		"_kic.example.com. 30 IN TXT \"*.apps.example.com.\"",
+		"_kic.example.com. 30 IN TXT \"external.example.com.\"",
+		"_kic.example.com. 30 IN TXT \"www.example.com.\"",
+		"external.example.com. 30 IN CNAME gateway.example.org.",
+		"mail.example.com. 300 IN A 192.0.2.25",
+		"www.example.com. 30 IN A 10.96.0.10",
+		"www.example.com. 30 IN AAAA fd00::10",
+	}
+	if actual := zone.lines(); !slices.Equal(actual, expected) {
+		t.Errorf("unexpected zone:\nExpected:\n%s\nActual:\n%s", strings.Join(expected, "\n"), strings.Join(actual, "\n"))
+	}
+
+	// Nothing is sent while the zone is up to date.
+	if applied, err = provider.Apply(context.Background(), records); err != nil || !applied.Drift.Empty() || zone.updates != 1 {
+		t.Errorf("expected no update once applied, got %d updates, drift %+v, error %v", zone.updates, applied.Drift, err)
+	}
+
+	// Records of hosts that are gone are removed, along with their ownership.
+	if _, err = provider.Apply(context.Background(), records[1:2]); err != nil {
+		t.Fatalf("Apply() returned error: %v", err)
+	}
+	expected = []string{
+		"_kic.example.com. 30 IN TXT \"www.example.com.\"",
+		"mail.example.com. 300 IN A 192.0.2.25",
+		"www.example.com. 30 IN A 10.96.0.10",
+		"www.example.com. 30 IN AAAA fd00::10",
+	}
+	if actual := zone.lines(); !slices.Equal(actual, expected) {
+		t.Errorf("unexpected zone:\nExpected:\n%s\nActual:\n%s", strings.Join(expected, "\n"), strings.Join(actual, "\n"))
+	}
+}
+
+func TestRFC2136ProviderRequiresTSIG(t *testing.T) {
+	_, addr := startTestZone(t, "example.com.")
+	r := &IngressReconciler{
+		Client:        newFakeClient(t),
+		Log:           logr.Discard(),
+		DNSProvider:   ProviderRFC2136,
+		RFC2136Server: addr,
+		RFC2136Zone:   "example.com",
+	}
+	provider, err := r.dnsProvider()
+	if err != nil {
+		t.Fatalf("dnsProvider() returned error: %v", err)
+	}
+	if _, err := provider.Apply(context.Background(), nil); err == nil {
+		t.Error("expected unsigned messages to be refused")
+	}
+}
@@ -0,0 +1,118 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+const (
+	// TargetSourceConfig takes Ingress targets from the class mapping and IngressControllerServiceName.
+	TargetSourceConfig = "config"
+	// TargetSourceStatus takes Ingress targets from their status.loadBalancer: the
+	// hostname if there is one, or else the IPs.
+	TargetSourceStatus = "status"
+	// TargetSourceService takes Ingress targets from the Service holding the
+	// load balancer address of their status, falling back to TargetSourceStatus.
+	TargetSourceService = "service"
+)
+
+// statusTarget returns the target of an Ingress derived from the addresses
+// its ingress controller published in status.loadBalancer, according to
+// TargetSource. It returns neither target nor IPs when the Ingress has no
+// address yet, or TargetSource does not use them.
+func (r *IngressReconciler) statusTarget(ingress *networkingv1.Ingress, lbServices map[string]string) (string, []string) {
+	if r.TargetSource != TargetSourceStatus && r.TargetSource != TargetSourceService {
+		return "", nil
+	}
+
+	var hostnames, ips []string
+	for _, lb := range ingress.Status.LoadBalancer.Ingress {
+		for _, address := range []string{lb.IP, lb.Hostname} {
+			if service, ok := lbServices[address]; ok && address != "" {
+				return service, nil
+			}
+		}
+		if lb.Hostname != "" {
+			hostnames = append(hostnames, lb.Hostname)
+		}
+		if lb.IP != "" {
+			ips = append(ips, lb.IP)
+		}
+	}
+
+	if len(hostnames) > 0 {
+		return slices.Min(hostnames), nil
+	}
+	slices.Sort(ips)
+	return "", slices.Compact(ips)
+}
+
+// loadBalancerServices maps the load balancer addresses and external IPs of
+// Services to their FQDN, for TargetSourceService. Addresses shared by several
+// Services go to the first one by namespace and name, whatever order the
+// cache lists them in.
+func (r *IngressReconciler) loadBalancerServices(ctx context.Context) (map[string]string, error) {
+	if r.TargetSource != TargetSourceService {
+		return nil, nil
+	}
+
+	var services corev1.ServiceList
+	if err := r.List(ctx, &services); err != nil {
+		return nil, err
+	}
+	sort.Slice(services.Items, func(i, j int) bool {
+		a, b := services.Items[i], services.Items[j]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
+	})
+	lbServices := map[string]string{}
+	for _, service := range services.Items {
+		addresses := slices.Clone(service.Spec.ExternalIPs)
+		for _, lb := range service.Status.LoadBalancer.Ingress {
+			addresses = append(addresses, lb.IP, lb.Hostname)
+		}
+		for _, address := range addresses {
+			if _, ok := lbServices[address]; address != "" && !ok {
+				lbServices[address] = r.serviceFQDN(service.Name, service.Namespace)
+			}
+		}
+	}
+	return lbServices, nil
+}
+
+// loadBalancerAddressesChanged lets Service updates through only when their
+// load balancer addresses or external IPs change, which is all
+// TargetSourceService cares about.
+var loadBalancerAddressesChanged = predicate.Funcs{
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		oldService, okOld := e.ObjectOld.(*corev1.Service)
+		newService, okNew := e.ObjectNew.(*corev1.Service)
+		return okOld && okNew && (!slices.Equal(oldService.Spec.ExternalIPs, newService.Spec.ExternalIPs) ||
+			!reflect.DeepEqual(oldService.Status.LoadBalancer, newService.Status.LoadBalancer))
+	},
+}
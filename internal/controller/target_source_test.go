@@ -0,0 +1,187 @@
+package controller
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+// withLoadBalancer sets the addresses an ingress controller published for an Ingress.
+func withLoadBalancer(ingress networkingv1.Ingress, addresses ...networkingv1.IngressLoadBalancerIngress) networkingv1.Ingress {
+	ingress.Status.LoadBalancer.Ingress = addresses
+	return ingress
+}
+
+func TestIngressRewriteRulesTargetSource(t *testing.T) {
+	const fallback = "ingress-nginx-controller.ingress-nginx.svc.cluster.local"
+	ingresses := []networkingv1.Ingress{
+		withLoadBalancer(newIngress("apps", "elb", "elb.example.com"),
+			networkingv1.IngressLoadBalancerIngress{Hostname: "a1b2.elb.amazonaws.com"}),
+		withLoadBalancer(newIngress("apps", "ips", "ips.example.com"),
+			networkingv1.IngressLoadBalancerIngress{IP: "fd00::20"},
+			networkingv1.IngressLoadBalancerIngress{IP: "192.0.2.20"},
+			networkingv1.IngressLoadBalancerIngress{IP: "192.0.2.20"}),
+		withLoadBalancer(newIngress("apps", "traefik", "traefik.example.com"),
+			networkingv1.IngressLoadBalancerIngress{IP: "192.0.2.30"}),
+		newIngress("apps", "pending", "pending.example.com"),
+	}
+	lbServices := map[string]string{"192.0.2.30": "traefik.traefik.svc.cluster.local"}
+
+	tests := []struct {
+		source   string
+		expected []rewriteRule
+	}{
+		{
+			source: TargetSourceConfig,
+			expected: []rewriteRule{
+				{Host: "elb.example.com", Target: fallback},
+				{Host: "ips.example.com", Target: fallback},
+				{Host: "traefik.example.com", Target: fallback},
+				{Host: "pending.example.com", Target: fallback},
+			},
+		},
+		{
+			source: TargetSourceStatus,
+			expected: []rewriteRule{
+				{Host: "elb.example.com", Target: "a1b2.elb.amazonaws.com"},
+				{Host: "ips.example.com", IPs: []string{"192.0.2.20", "fd00::20"}},
+				{Host: "traefik.example.com", IPs: []string{"192.0.2.30"}},
+				{Host: "pending.example.com", Target: fallback},
+			},
+		},
+		{
+			source: TargetSourceService,
+			expected: []rewriteRule{
+				{Host: "elb.example.com", Target: "a1b2.elb.amazonaws.com"},
+				{Host: "ips.example.com", IPs: []string{"192.0.2.20", "fd00::20"}},
+				{Host: "traefik.example.com", Target: "traefik.traefik.svc.cluster.local"},
+				{Host: "pending.example.com", Target: fallback},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			r := &IngressReconciler{IngressControllerServiceName: fallback, TargetSource: tt.source}
+			services := lbServices
+			if tt.source != TargetSourceService {
+				// loadBalancerServices only maps addresses in service mode.
+				services = nil
+			}
+			rules := withoutSources(r.ingressRewriteRules(ingresses, services))
+			if !reflect.DeepEqual(rules, tt.expected) {
+				t.Errorf("ingressRewriteRules():\nExpected: %v\nActual:   %v", tt.expected, rules)
+			}
+		})
+	}
+}
+
+func TestLoadBalancerServices(t *testing.T) {
+	traefik := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "traefik", Name: "traefik"},
+		Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeLoadBalancer, ExternalIPs: []string{"192.0.2.31"}},
+		Status: corev1.ServiceStatus{LoadBalancer: corev1.LoadBalancerStatus{
+			Ingress: []corev1.LoadBalancerIngress{{IP: "192.0.2.30"}, {Hostname: "traefik.elb.amazonaws.com"}},
+		}},
+	}
+	r := &IngressReconciler{Client: newFakeClient(t, traefik), ClusterDomain: "cluster.local", TargetSource: TargetSourceService}
+	lbServices, err := r.loadBalancerServices(context.Background())
+	if err != nil {
+		t.Fatalf("loadBalancerServices() returned error: %v", err)
+	}
+	expected := map[string]string{
+		"192.0.2.30":                "traefik.traefik.svc.cluster.local",
+		"192.0.2.31":                "traefik.traefik.svc.cluster.local",
+		"traefik.elb.amazonaws.com": "traefik.traefik.svc.cluster.local",
+	}
+	if !reflect.DeepEqual(lbServices, expected) {
+		t.Errorf("loadBalancerServices() = %v, expected %v", lbServices, expected)
+	}
+}
+
+func TestLoadBalancerServicesSharedAddress(t *testing.T) {
+	// MetalLB lets Services share an IP with the allow-shared-ip annotation
+	shared := func(namespace, name string) *corev1.Service {
+		return &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+			Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeLoadBalancer},
+			Status: corev1.ServiceStatus{LoadBalancer: corev1.LoadBalancerStatus{
+				Ingress: []corev1.LoadBalancerIngress{{IP: "192.0.2.30"}},
+			}},
+		}
+	}
+	// The cache lists Services in no particular order
+	c := newFakeClientBuilder(t).WithObjects(shared("traefik", "traefik"), shared("ingress", "nginx")).Build()
+	reversed := interceptor.NewClient(c, interceptor.Funcs{
+		List: func(ctx context.Context, c client.WithWatch, list client.ObjectList, opts ...client.ListOption) error {
+			if err := c.List(ctx, list, opts...); err != nil {
+				return err
+			}
+			if services, ok := list.(*corev1.ServiceList); ok {
+				slices.Reverse(services.Items)
+			}
+			return nil
+		},
+	})
+	r := &IngressReconciler{Client: reversed, ClusterDomain: "cluster.local", TargetSource: TargetSourceService}
+	lbServices, err := r.loadBalancerServices(context.Background())
+	if err != nil {
+		t.Fatalf("loadBalancerServices() returned error: %v", err)
+	}
+	expected := map[string]string{"192.0.2.30": "nginx.ingress.svc.cluster.local"}
+	if !reflect.DeepEqual(lbServices, expected) {
+		t.Errorf("loadBalancerServices() = %v, expected %v", lbServices, expected)
+	}
+}
+
+func TestUpdateDNSWithLoadBalancerIPs(t *testing.T) {
+	web := withLoadBalancer(newIngress("apps", "web", "www.example.com", "*.apps.example.com"),
+		networkingv1.IngressLoadBalancerIngress{IP: "192.0.2.20"})
+	coreDNS := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: coreDNSConfigMapName, Namespace: coreDNSConfigMapNamespace},
+		Data:       map[string]string{corefileKey: ".:53 {\n    kubernetes cluster.local\n}\n"},
+	}
+	c := newFakeClient(t, &web, coreDNS)
+	r := &IngressReconciler{Client: c, Log: logr.Discard(), TargetSource: TargetSourceStatus}
+	if err := r.updateDNS(context.Background()); err != nil {
+		t.Fatalf("updateDNS() returned error: %v", err)
+	}
+
+	var updated corev1.ConfigMap
+	if err := c.Get(context.Background(), client.ObjectKeyFromObject(coreDNS), &updated); err != nil {
+		t.Fatal(err)
+	}
+	expected := ".:53 {\n" +
+		"    kubernetes cluster.local\n" +
+		managedRulesBeginMarker + "\n" +
+		"template IN A {\n" +
+		`    match ^www\.example\.com\.$` + "\n" +
+		`    answer "{{ .Name }} 30 IN A 192.0.2.20"` + "\n" +
+		"    fallthrough\n" +
+		"}\n" +
+		"template IN AAAA {\n" +
+		`    match ^www\.example\.com\.$` + "\n" +
+		"    fallthrough\n" +
+		"}\n" +
+		"template IN A {\n" +
+		`    match ^[^.]+\.apps\.example\.com\.$` + "\n" +
+		`    answer "{{ .Name }} 30 IN A 192.0.2.20"` + "\n" +
+		"    fallthrough\n" +
+		"}\n" +
+		"template IN AAAA {\n" +
+		`    match ^[^.]+\.apps\.example\.com\.$` + "\n" +
+		"    fallthrough\n" +
+		"}\n" +
+		managedRulesEndMarker + "\n" +
+		"}\n"
+	if updated.Data[corefileKey] != expected {
+		t.Errorf("unexpected Corefile:\nExpected:\n%s\nActual:\n%s", expected, updated.Data[corefileKey])
+	}
+}
@@ -0,0 +1,150 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// BackendFile serves the Zone authoritatively from a zone file loaded by the file plugin.
+	BackendFile = "file"
+
+	// zoneTTL is the TTL of every record of the zone, and its negative caching TTL.
+	zoneTTL = 30
+	// coreDNSConfigDir is where the coredns ConfigMap is mounted in the CoreDNS pods.
+	coreDNSConfigDir = "/etc/coredns"
+)
+
+// zoneFileKey is the ConfigMap key, and file name, of the zone file.
+func (r *IngressReconciler) zoneFileKey() string {
+	return "db." + strings.TrimSuffix(r.Zone, ".")
+}
+
+// zoneFilePath is where CoreDNS finds the zone file: next to the imported
+// rules with a managed ConfigMap, next to the Corefile otherwise.
+func (r *IngressReconciler) zoneFilePath() string {
+	dir := coreDNSConfigDir
+	if r.ManagedConfigMapName != "" {
+		dir = path.Dir(r.CoreDNSImportPath)
+	}
+	return path.Join(dir, r.zoneFileKey())
+}
+
+// inZone reports whether a host, wildcards included, belongs to the zone.
+func inZone(host, zone string) bool {
+	host, zone = strings.ToLower(strings.TrimSuffix(host, ".")), strings.ToLower(strings.TrimSuffix(zone, "."))
+	return host == zone || strings.HasSuffix(host, "."+zone)
+}
+
+// renderZoneRules renders the rules for the file backend: a file plugin
+// directive for the Zone, and the zone file with a record for every host in
+// the zone. Hosts outside the zone, and the zone apex when its target has no
+// ClusterIP since it cannot be a CNAME, keep their rewrite rule. previous is
+// the current zone file, whose serial is kept when the records did not change
+// and bumped otherwise.
+func (r *IngressReconciler) renderZoneRules(ctx context.Context, rules []rewriteRule, previous string, now time.Time) (string, string, error) {
+	zone := strings.ToLower(strings.TrimSuffix(r.Zone, "."))
+
+	var records, rewrites strings.Builder
+	for _, rule := range rules {
+		if !inZone(rule.Host, zone) {
+			rewrites.WriteString(rule.String())
+			continue
+		}
+
+		owner := strings.TrimSuffix(strings.TrimSuffix(strings.ToLower(rule.Host), zone), ".")
+		if owner == "" {
+			owner = "@"
+		}
+		ips, err := r.ruleIPs(ctx, rule)
+		if err != nil {
+			return "", "", err
+		}
+		switch {
+		case len(ips) > 0:
+			for _, ip := range ips {
+				recordType := "A"
+				if net.ParseIP(ip).To4() == nil {
+					recordType = "AAAA"
+				}
+				fmt.Fprintf(&records, "%s IN %s %s\n", owner, recordType, ip)
+			}
+		case owner == "@":
+			rewrites.WriteString(rule.String())
+		default:
+			fmt.Fprintf(&records, "%s IN CNAME %s.\n", owner, strings.TrimSuffix(rule.Target, "."))
+		}
+	}
+
+	nameServer := "kube-dns.kube-system.svc." + r.ClusterDomain + "."
+	render := func(serial uint32) string {
+		return fmt.Sprintf("$ORIGIN %s.\n$TTL %d\n", zone, zoneTTL) +
+			fmt.Sprintf("@ IN SOA %s hostmaster.%s. %d 7200 1800 86400 %d\n", nameServer, zone, serial, zoneTTL) +
+			fmt.Sprintf("@ IN NS %s\n", nameServer) +
+			records.String()
+	}
+
+	serial, ok := zoneSerial(previous)
+	if !ok || render(serial) != previous {
+		serial = nextSerial(serial, now)
+	}
+	directive := fmt.Sprintf("file %s %s\n", r.zoneFilePath(), zone)
+	return directive + rewrites.String(), render(serial), nil
+}
+
+// zoneSerial returns the serial of the SOA record of a zone file.
+func zoneSerial(zoneFile string) (uint32, bool) {
+	for _, line := range strings.Split(zoneFile, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 7 && fields[2] == "SOA" {
+			serial, err := strconv.ParseUint(fields[5], 10, 32)
+			return uint32(serial), err == nil
+		}
+	}
+	return 0, false
+}
+
+// withoutZoneSerial returns a zone file without the serial of its SOA record.
+func withoutZoneSerial(zoneFile string) string {
+	lines := strings.Split(zoneFile, "\n")
+	for i, line := range lines {
+		if fields := strings.Fields(line); len(fields) >= 7 && fields[2] == "SOA" {
+			fields[5] = "0"
+			lines[i] = strings.Join(fields, " ")
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// nextSerial returns the serial following the given one, in the YYYYMMDDnn
+// format recommended by RFC 1912: the first serial of the day, or the given
+// serial plus one if it is already past it.
+func nextSerial(serial uint32, now time.Time) uint32 {
+	y, m, d := now.UTC().Date()
+	today := uint32(y*1000000 + int(m)*10000 + d*100)
+	if serial < today {
+		return today
+	}
+	return serial + 1
+}
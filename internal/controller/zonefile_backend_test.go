@@ -0,0 +1,116 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestRenderZoneRules(t *testing.T) {
+	const (
+		nginx    = "nginx.ingress.svc.cluster.local"
+		external = "gateway.example.org"
+	)
+	c := newFakeClient(t, newService("ingress", "nginx", "10.96.0.10", "fd00::10"))
+	r := &IngressReconciler{Client: c, Log: logr.Discard(), ClusterDomain: "cluster.local", Zone: "example.com."}
+	rules := []rewriteRule{
+		{Host: "example.com", Target: external},
+		{Host: "api.example.com", Target: external},
+		{Host: "www.Example.com", Target: nginx},
+		{Host: "other.example.net", Target: nginx},
+		{Host: "*.apps.example.com", Target: nginx},
+	}
+	today := time.Date(2025, time.March, 4, 12, 0, 0, 0, time.UTC)
+
+	directives, zoneFile, err := r.renderZoneRules(context.Background(), rules, "", today)
+	if err != nil {
+		t.Fatalf("renderZoneRules() returned error: %v", err)
+	}
+	expectedDirectives := "file /etc/coredns/db.example.com example.com\n" +
+		"rewrite name example.com " + external + "\n" +
+		"rewrite name other.example.net " + nginx + "\n"
+	if directives != expectedDirectives {
+		t.Errorf("unexpected directives:\nExpected:\n%s\nActual:\n%s", expectedDirectives, directives)
+	}
+	expectedZoneFile := "$ORIGIN example.com.\n" +
+		"$TTL 30\n" +
+		"@ IN SOA kube-dns.kube-system.svc.cluster.local. hostmaster.example.com. 2025030400 7200 1800 86400 30\n" +
+		"@ IN NS kube-dns.kube-system.svc.cluster.local.\n" +
+		"api IN CNAME gateway.example.org.\n" +
+		"www IN A 10.96.0.10\n" +
+		"www IN AAAA fd00::10\n" +
+		"*.apps IN A 10.96.0.10\n" +
+		"*.apps IN AAAA fd00::10\n"
+	if zoneFile != expectedZoneFile {
+		t.Errorf("unexpected zone file:\nExpected:\n%s\nActual:\n%s", expectedZoneFile, zoneFile)
+	}
+
+	// The serial is kept while the records do not change, and bumped when they do.
+	if _, unchanged, _ := r.renderZoneRules(context.Background(), rules, zoneFile, today.Add(time.Hour)); unchanged != zoneFile {
+		t.Errorf("expected the zone file to be kept, got:\n%s", unchanged)
+	}
+	_, changed, _ := r.renderZoneRules(context.Background(), rules[:2], zoneFile, today.Add(time.Hour))
+	if serial, _ := zoneSerial(changed); serial != 2025030401 {
+		t.Errorf("expected serial 2025030401, got %d", serial)
+	}
+}
+
+func TestNextSerial(t *testing.T) {
+	today := time.Date(2025, time.March, 4, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		serial   uint32
+		expected uint32
+	}{
+		{serial: 0, expected: 2025030400},
+		{serial: 2025010107, expected: 2025030400},
+		{serial: 2025030400, expected: 2025030401},
+		{serial: 2025030599, expected: 2025030600},
+	}
+	for _, tt := range tests {
+		if actual := nextSerial(tt.serial, today); actual != tt.expected {
+			t.Errorf("nextSerial(%d) = %d, expected %d", tt.serial, actual, tt.expected)
+		}
+	}
+}
+
+func TestUpdateCoreDNSConfigMapWithZoneFile(t *testing.T) {
+	web := newIngress("apps", "web", "www.example.com")
+	coreDNS := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: coreDNSConfigMapName, Namespace: coreDNSConfigMapNamespace},
+		Data:       map[string]string{corefileKey: ".:53 {\n    kubernetes cluster.local\n}\n"},
+	}
+	c := newFakeClient(t, &web, coreDNS, newService("ingress", "nginx", "10.96.0.10"))
+	r := &IngressReconciler{
+		Client:                       c,
+		Log:                          logr.Discard(),
+		IngressControllerServiceName: "nginx.ingress.svc.cluster.local",
+		ClusterDomain:                "cluster.local",
+		Backend:                      BackendFile,
+		Zone:                         "example.com",
+	}
+	if err := r.updateDNS(context.Background()); err != nil {
+		t.Fatalf("updateDNS() returned error: %v", err)
+	}
+
+	var updated corev1.ConfigMap
+	if err := c.Get(context.Background(), client.ObjectKeyFromObject(coreDNS), &updated); err != nil {
+		t.Fatal(err)
+	}
+	expectedCorefile := ".:53 {\n" +
+		"    kubernetes cluster.local\n" +
+		managedRulesBeginMarker + "\n" +
+		"file /etc/coredns/db.example.com example.com\n" +
+		managedRulesEndMarker + "\n" +
+		"}\n"
+	if updated.Data[corefileKey] != expectedCorefile {
+		t.Errorf("unexpected Corefile:\n%s", updated.Data[corefileKey])
+	}
+	if _, ok := zoneSerial(updated.Data["db.example.com"]); !ok {
+		t.Errorf("expected a zone file next to the Corefile, got %v", updated.Data)
+	}
+}
@@ -0,0 +1,348 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package corefile parses CoreDNS Corefiles into a tree of server blocks,
+// plugins and arguments, and prints them back out.
+//
+// Parsed nodes remember the exact text and indentation they were read from, so
+// printing an unmodified Corefile reproduces it byte for byte, comments
+// included. Nodes that are added or changed are printed with the indentation
+// of their siblings.
+package corefile
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// indentUnit is used for nested nodes when no sibling indentation is known.
+const indentUnit = "    "
+
+// Corefile is a parsed Corefile.
+type Corefile struct {
+	// Nodes are the top-level nodes: server blocks, comments and blank lines.
+	Nodes []*Node
+}
+
+// Node is a single line of a Corefile and, for server blocks and plugins
+// with a configuration block, everything nested in it.
+//
+// A directive has a Name, which is the first token of its line: the first key
+// of a server block or the name of a plugin. Comment lines only have a
+// Comment and blank lines have neither.
+type Node struct {
+	Name string
+	Args []string
+	// Comment is the text of a comment line, or the trailing comment of a
+	// directive, including the leading '#'.
+	Comment string
+	// Block holds the nested nodes of a directive opening a { } block. It is
+	// nil for directives without a block.
+	Block []*Node
+
+	// parsed is set for nodes read from a Corefile: their text is printed as
+	// it was read as long as the node is not modified. placed is set while
+	// their indentation and brace lines are still those of the source.
+	// pinned nodes keep their indentation wherever they are moved, without
+	// lending it to new siblings.
+	parsed bool
+	placed bool
+	pinned bool
+	indent string
+	text   string
+	// open is the line holding a "{" that was not on the directive's line,
+	// and close the line holding the matching "}". Both keep their source
+	// indentation.
+	open  string
+	close string
+	orig  []string
+	// inline is the block of a directive whose block was opened and closed on
+	// its line, as it was read. Such a directive is printed on a single line
+	// until its block is modified.
+	inline []*Node
+}
+
+// NewDirective returns a directive without a block.
+func NewDirective(name string, args ...string) *Node {
+	return &Node{Name: name, Args: args}
+}
+
+// NewComment returns a comment line. A leading '#' is added if missing.
+func NewComment(text string) *Node {
+	if !strings.HasPrefix(text, "#") {
+		text = "# " + text
+	}
+	return &Node{Comment: text}
+}
+
+// IsComment reports whether the node is a comment line.
+func (n *Node) IsComment() bool {
+	return n.Name == "" && n.Comment != ""
+}
+
+// IsBlank reports whether the node is a blank line.
+func (n *Node) IsBlank() bool {
+	return n.Name == "" && n.Comment == ""
+}
+
+// HasBlock reports whether the directive opens a { } block.
+func (n *Node) HasBlock() bool {
+	return n.Block != nil
+}
+
+// Keys returns the keys of a server block, such as ".:53" or "example.com:53".
+func (n *Node) Keys() []string {
+	var keys []string
+	for _, token := range append([]string{n.Name}, n.Args...) {
+		for _, key := range strings.Split(token, ",") {
+			if key != "" {
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys
+}
+
+// Directive returns the first directive with the given name directly inside
+// the node's block and its index, or nil and -1.
+func (n *Node) Directive(name string) (*Node, int) {
+	for i, child := range n.Block {
+		if child.Name == name {
+			return child, i
+		}
+	}
+	return nil, -1
+}
+
+// Detach forgets where a parsed node and its children were placed, so that
+// they take the indentation of their new siblings when printed. Their text is
+// kept as is.
+func (n *Node) Detach() {
+	n.placed, n.pinned = false, false
+	for _, child := range n.Block {
+		child.Detach()
+	}
+}
+
+// Pin prints the node at the given indentation wherever it is moved, rather
+// than at the indentation of its siblings. The nodes of its block keep theirs.
+// Pinned nodes are ignored when new siblings look for an indentation to take.
+func (n *Node) Pin(indent string) {
+	n.placed, n.pinned, n.indent = true, true, indent
+}
+
+// Clone returns a deep copy of the node and its block, printed like the
+// original until it is modified.
+func (n *Node) Clone() *Node {
+	clone := *n
+	clone.Args = slices.Clone(n.Args)
+	clone.orig = slices.Clone(n.orig)
+	if n.Block != nil {
+		clone.Block = make([]*Node, len(n.Block))
+		for i, child := range n.Block {
+			clone.Block[i] = child.Clone()
+		}
+	}
+	if n.inline != nil {
+		clone.inline = nil
+		if slices.Equal(n.Block, n.inline) {
+			clone.inline = slices.Clone(clone.Block)
+		}
+	}
+	return &clone
+}
+
+// ServerBlocks returns the top-level directives that open a block.
+func (c *Corefile) ServerBlocks() []*Node {
+	var blocks []*Node
+	for _, node := range c.Nodes {
+		if node.Name != "" && node.HasBlock() {
+			blocks = append(blocks, node)
+		}
+	}
+	return blocks
+}
+
+// Walk calls fn for every node of the Corefile, depth first, along with the
+// slice that holds it and its index in that slice. The parent is nil for
+// top-level nodes. Walk stops descending into a node when fn returns false.
+func (c *Corefile) Walk(fn func(parent *Node, siblings []*Node, i int) bool) {
+	walk(nil, c.Nodes, fn)
+}
+
+func walk(parent *Node, nodes []*Node, fn func(parent *Node, siblings []*Node, i int) bool) {
+	for i, node := range nodes {
+		if fn(parent, nodes, i) && node.HasBlock() {
+			walk(node, node.Block, fn)
+		}
+	}
+}
+
+// String prints the Corefile.
+func (c *Corefile) String() string {
+	var b strings.Builder
+	printNodes(&b, c.Nodes, "")
+	return b.String()
+}
+
+// String prints the node and its block as they would appear at the top level.
+func (n *Node) String() string {
+	var b strings.Builder
+	printNodes(&b, []*Node{n}, "")
+	return b.String()
+}
+
+// unchanged reports whether the tokens of a parsed node still match its text,
+// along with the block written on the same line, if any.
+func (n *Node) unchanged() bool {
+	if !slices.Equal(n.tokens(), n.orig) {
+		return false
+	}
+	if n.inline == nil {
+		return true
+	}
+	if !slices.Equal(n.Block, n.inline) {
+		return false
+	}
+	for _, child := range n.Block {
+		if !child.unchanged() {
+			return false
+		}
+	}
+	return true
+}
+
+// inlineText formats a directive and the block written on its line.
+func (n *Node) inlineText() string {
+	parts := []string{quote(n.Name)}
+	for _, arg := range n.Args {
+		parts = append(parts, quote(arg))
+	}
+	if n.HasBlock() {
+		parts = append(parts, "{")
+		for _, child := range n.Block {
+			parts = append(parts, child.inlineText())
+		}
+		parts = append(parts, "}")
+	}
+	return strings.Join(parts, " ")
+}
+
+// tokens returns the node's tokens and comment, used to detect modifications.
+func (n *Node) tokens() []string {
+	tokens := make([]string, 0, len(n.Args)+2)
+	tokens = append(tokens, n.Name)
+	tokens = append(tokens, n.Args...)
+	return append(tokens, n.Comment)
+}
+
+// printNodes prints a list of sibling nodes. New nodes take the indentation
+// of the first parsed sibling, or one unit more than their parent.
+func printNodes(b *strings.Builder, nodes []*Node, defaultIndent string) {
+	indent := defaultIndent
+	for _, node := range nodes {
+		if node.placed && !node.pinned && !node.IsBlank() {
+			indent = node.indent
+			break
+		}
+	}
+
+	for _, node := range nodes {
+		if node.placed {
+			printNode(b, node, node.indent)
+		} else {
+			printNode(b, node, indent)
+		}
+	}
+}
+
+func printNode(b *strings.Builder, n *Node, indent string) {
+	switch {
+	case n.IsBlank():
+		if n.placed {
+			b.WriteString(n.indent)
+		}
+		b.WriteString("\n")
+		return
+	case n.parsed && n.unchanged() && n.inline != nil:
+		b.WriteString(indent + n.text + "\n")
+		return
+	case n.parsed && n.unchanged():
+		b.WriteString(indent + n.text + "\n")
+	default:
+		b.WriteString(indent + n.render() + "\n")
+	}
+
+	if !n.HasBlock() {
+		return
+	}
+	if n.open != "" {
+		b.WriteString(n.braceLine(n.open, indent))
+	}
+	printNodes(b, n.Block, indent+indentUnit)
+	if n.close != "" {
+		b.WriteString(n.braceLine(n.close, indent))
+	} else {
+		b.WriteString(indent + "}\n")
+	}
+}
+
+// braceLine prints a line holding a brace of the node, keeping its source
+// indentation while the node is placed.
+func (n *Node) braceLine(line, indent string) string {
+	if n.placed {
+		return line + "\n"
+	}
+	return indent + strings.TrimLeft(line, " \t") + "\n"
+}
+
+// render formats the node's line, quoting tokens as needed.
+func (n *Node) render() string {
+	var parts []string
+	if n.Name != "" {
+		parts = append(parts, quote(n.Name))
+	}
+	for _, arg := range n.Args {
+		parts = append(parts, quote(arg))
+	}
+	if n.HasBlock() && n.open == "" {
+		parts = append(parts, "{")
+	}
+	if n.Comment != "" {
+		parts = append(parts, n.Comment)
+	}
+	return strings.Join(parts, " ")
+}
+
+// quote wraps a token in double quotes if it would not survive tokenizing
+// otherwise.
+func quote(token string) string {
+	if token != "" && token != "{" && token != "}" && !strings.ContainsAny(token, " \t\"#") {
+		return token
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(token) + `"`
+}
+
+// ParseError reports a Corefile syntax error.
+type ParseError struct {
+	Line int
+	Msg  string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("corefile: line %d: %s", e.Line, e.Msg)
+}
@@ -0,0 +1,302 @@
+package corefile
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+const kubeadmCorefile = `.:53 {
+    errors
+    health {
+       lameduck 5s
+    }
+    ready
+    # internal names
+    kubernetes cluster.local in-addr.arpa ip6.arpa {
+       pods insecure
+       fallthrough in-addr.arpa ip6.arpa
+       ttl 30
+    }
+    prometheus :9153
+    forward . /etc/resolv.conf {
+       max_concurrent 1000
+    }
+    cache 30 # seconds
+    loop
+    reload
+    loadbalance
+}
+
+corp.internal:53 {
+	errors
+	forward . 10.0.0.10
+}
+`
+
+func TestParseRoundTrip(t *testing.T) {
+	tests := []struct {
+		name     string
+		corefile string
+	}{
+		{name: "empty", corefile: ""},
+		{name: "kubeadm default with comments", corefile: kubeadmCorefile},
+		{
+			name: "brace on its own line and quoted arguments",
+			corefile: "# header\n" +
+				"example.org:53\n" +
+				"{\n" +
+				"  expression \"label('kubernetes/client-namespace') != \\\"kube-system\\\"\" {\n" +
+				"    rewrite name a.example.org b.example.org\n" +
+				"  }   \n" +
+				"}\n",
+		},
+		{name: "whitespace-only lines", corefile: ".:53 {\n    errors\n  \t\n}\n"},
+		{
+			name: "blocks on one line",
+			corefile: ".:53 { whoami }\n" +
+				"example.org:53 {\n" +
+				"    log  { class error }   # errors only\n" +
+				"    health {}\n" +
+				"    forward . 10.0.0.10 { policy { sequential } }\n" +
+				"}\n",
+		},
+		{name: "no trailing newline", corefile: ".:53 {\n    errors\n}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := Parse(tt.corefile)
+			if err != nil {
+				t.Fatalf("Parse() returned error: %v", err)
+			}
+			expected := tt.corefile
+			if expected != "" && expected[len(expected)-1] != '\n' {
+				expected += "\n"
+			}
+			if actual := c.String(); actual != expected {
+				t.Errorf("String() did not round-trip.\nExpected:\n%q\nActual:\n%q", expected, actual)
+			}
+		})
+	}
+}
+
+func TestParseTree(t *testing.T) {
+	c, err := Parse(kubeadmCorefile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blocks := c.ServerBlocks()
+	if len(blocks) != 2 {
+		t.Fatalf("expected 2 server blocks, got %d", len(blocks))
+	}
+	if keys := blocks[1].Keys(); !reflect.DeepEqual(keys, []string{"corp.internal:53"}) {
+		t.Errorf("unexpected keys %v", keys)
+	}
+
+	kubernetes, i := blocks[0].Directive("kubernetes")
+	if kubernetes == nil || i != 4 {
+		t.Fatalf("expected kubernetes directive at index 4, got %v at %d", kubernetes, i)
+	}
+	if !reflect.DeepEqual(kubernetes.Args, []string{"cluster.local", "in-addr.arpa", "ip6.arpa"}) {
+		t.Errorf("unexpected kubernetes args %v", kubernetes.Args)
+	}
+	if !blocks[0].Block[3].IsComment() {
+		t.Errorf("expected a comment before the kubernetes directive")
+	}
+	if cache, _ := blocks[0].Directive("cache"); cache.Comment != "# seconds" || !reflect.DeepEqual(cache.Args, []string{"30"}) {
+		t.Errorf("unexpected cache directive %+v", cache)
+	}
+}
+
+func TestPrintModified(t *testing.T) {
+	c, err := Parse(kubeadmCorefile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks := c.ServerBlocks()
+
+	// Changed directives are rendered from their tokens, new directives take
+	// the indentation of their siblings.
+	cache, _ := blocks[0].Directive("cache")
+	cache.Args = []string{"60"}
+	blocks[1].Block = append(blocks[1].Block, NewDirective("log"), &Node{
+		Name:  "expression",
+		Args:  []string{"a == 'b'"},
+		Block: []*Node{NewDirective("rewrite", "name", "x.example.org", "y.example.org")},
+	})
+
+	expected := `.:53 {
+    errors
+    health {
+       lameduck 5s
+    }
+    ready
+    # internal names
+    kubernetes cluster.local in-addr.arpa ip6.arpa {
+       pods insecure
+       fallthrough in-addr.arpa ip6.arpa
+       ttl 30
+    }
+    prometheus :9153
+    forward . /etc/resolv.conf {
+       max_concurrent 1000
+    }
+    cache 60 # seconds
+    loop
+    reload
+    loadbalance
+}
+
+corp.internal:53 {
+	errors
+	forward . 10.0.0.10
+	log
+	expression "a == 'b'" {
+	    rewrite name x.example.org y.example.org
+	}
+}
+`
+	if actual := c.String(); actual != expected {
+		t.Errorf("String() mismatch.\nExpected:\n%s\nActual:\n%s", expected, actual)
+	}
+}
+
+func TestPrintModifiedOneLineBlocks(t *testing.T) {
+	c, err := Parse(".:53 { whoami }\nexample.org:53 {\n  log { class error }\n  forward . 10.0.0.10 { policy { sequential } }\n}\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks := c.ServerBlocks()
+
+	// A one-line block is spread over several lines once its block changes,
+	// and printed as it was read otherwise.
+	blocks[0].Block = append(blocks[0].Block, NewDirective("log"))
+	log, _ := blocks[1].Directive("log")
+	log.Block[0].Args = []string{"denial"}
+
+	expected := ".:53 {\n" +
+		"    whoami\n" +
+		"    log\n" +
+		"}\n" +
+		"example.org:53 {\n" +
+		"  log {\n" +
+		"      class denial\n" +
+		"  }\n" +
+		"  forward . 10.0.0.10 { policy { sequential } }\n" +
+		"}\n"
+	if actual := c.String(); actual != expected {
+		t.Errorf("String() mismatch.\nExpected:\n%s\nActual:\n%s", expected, actual)
+	}
+
+	forward, _ := blocks[1].Directive("forward")
+	if policy := forward.Block[0]; policy.Name != "policy" || len(policy.Block) != 1 || policy.Block[0].Name != "sequential" {
+		t.Errorf("unexpected forward block %+v", forward.Block)
+	}
+}
+
+func TestDetach(t *testing.T) {
+	fragment, err := Parse("expression \"a\" {\nrewrite name x.example.org y.example.org\n}\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := Parse(".:53 {\n  errors\n}\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, node := range fragment.Nodes {
+		node.Detach()
+	}
+	block := c.ServerBlocks()[0]
+	block.Block = append(block.Block, fragment.Nodes...)
+
+	expected := ".:53 {\n  errors\n  expression \"a\" {\n      rewrite name x.example.org y.example.org\n  }\n}\n"
+	if actual := c.String(); actual != expected {
+		t.Errorf("String() mismatch.\nExpected:\n%q\nActual:\n%q", expected, actual)
+	}
+}
+
+func TestClone(t *testing.T) {
+	c, err := Parse("cluster.local:53 {\n  errors\n  cache {\n    success 9984 30\n  }\n}\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	original := c.String()
+
+	clone := c.ServerBlocks()[0].Clone()
+	clone.Name = "example.com:53"
+	cache, _ := clone.Directive("cache")
+	cache.Block[0].Args[0] = "100"
+
+	if actual := c.String(); actual != original {
+		t.Errorf("modifying the clone changed the original:\n%s", actual)
+	}
+	expected := "example.com:53 {\n  errors\n  cache {\n    success 100 30\n  }\n}\n"
+	if actual := clone.String(); actual != expected {
+		t.Errorf("String() mismatch.\nExpected:\n%q\nActual:\n%q", expected, actual)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		corefile string
+		line     int
+	}{
+		{name: "unclosed block", corefile: ".:53 {\n    errors\n", line: 2},
+		{name: "unexpected closing brace", corefile: ".:53 {\n}\n}\n", line: 3},
+		{name: "block opened in the middle of a line", corefile: ".:53 { errors\n}\n", line: 1},
+		{name: "tokens after a one-line block", corefile: ".:53 {\n    log { class error } stdout\n}\n", line: 2},
+		{name: "one-line block opening another block", corefile: ".:53 { log } {\n}\n", line: 1},
+		{name: "unterminated quote", corefile: ".:53 {\n    expression \"a {\n}\n", line: 2},
+		{name: "opening brace without directive", corefile: "{\n}\n", line: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.corefile)
+			var parseErr *ParseError
+			if !errors.As(err, &parseErr) {
+				t.Fatalf("expected a ParseError, got %v", err)
+			}
+			if parseErr.Line != tt.line {
+				t.Errorf("expected error on line %d, got %v", tt.line, err)
+			}
+		})
+	}
+}
+
+func TestServerBlock(t *testing.T) {
+	c, err := Parse(kubeadmCorefile + "tls://secure.example.org {\n    errors\n}\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		key      string
+		expected string
+	}{
+		{key: ".:53", expected: ".:53"},
+		{key: ".", expected: ".:53"},
+		{key: "dns://.:53", expected: ".:53"},
+		{key: "CORP.internal.:53", expected: "corp.internal:53"},
+		{key: "corp.internal", expected: "corp.internal:53"},
+		{key: "corp.internal:5353"},
+		{key: "tls://secure.example.org:853", expected: "tls://secure.example.org"},
+		{key: "secure.example.org"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			block := c.ServerBlock(ParseServerKey(tt.key))
+			switch {
+			case block == nil && tt.expected != "":
+				t.Errorf("expected server block %q, got none", tt.expected)
+			case block != nil && block.Name != tt.expected:
+				t.Errorf("expected server block %q, got %q", tt.expected, block.Name)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package corefile
+
+import (
+	"strings"
+)
+
+// defaultPorts are the ports CoreDNS listens on when a server block key
+// omits it, by transport.
+var defaultPorts = map[string]string{
+	"dns":   "53",
+	"tls":   "853",
+	"grpc":  "443",
+	"https": "443",
+}
+
+// ServerKey identifies what a server block serves: a zone on a port, over a
+// transport.
+type ServerKey struct {
+	Scheme string
+	Zone   string
+	Port   string
+}
+
+// ParseServerKey parses a server block key such as ".:53", "example.org" or
+// "tls://example.org:853", filling in the defaults CoreDNS would use. Zones
+// are lower-cased and fully qualified.
+func ParseServerKey(key string) ServerKey {
+	k := ServerKey{Scheme: "dns"}
+	if scheme, rest, ok := strings.Cut(key, "://"); ok {
+		k.Scheme, key = strings.ToLower(scheme), rest
+	}
+	if i := strings.LastIndex(key, ":"); i != -1 {
+		key, k.Port = key[:i], key[i+1:]
+	}
+	if k.Port == "" {
+		k.Port = defaultPorts[k.Scheme]
+	}
+
+	k.Zone = strings.ToLower(key)
+	if k.Zone == "" {
+		k.Zone = "."
+	}
+	if !strings.HasSuffix(k.Zone, ".") {
+		k.Zone += "."
+	}
+	return k
+}
+
+// String formats the key the way it is written in a Corefile.
+func (k ServerKey) String() string {
+	s := k.Zone + ":" + k.Port
+	if k.Scheme != "dns" {
+		s = k.Scheme + "://" + s
+	}
+	return s
+}
+
+// Serves reports whether one of the server block's keys is the given key.
+func (n *Node) Serves(key ServerKey) bool {
+	for _, k := range n.Keys() {
+		if ParseServerKey(k) == key {
+			return true
+		}
+	}
+	return false
+}
+
+// ServerBlock returns the first server block serving the given key, or nil.
+func (c *Corefile) ServerBlock(key ServerKey) *Node {
+	for _, block := range c.ServerBlocks() {
+		if block.Serves(key) {
+			return block
+		}
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package corefile
+
+import (
+	"errors"
+	"slices"
+	"strings"
+)
+
+var errUnterminatedQuote = errors.New("unterminated quoted string")
+
+// token is a single word of a Corefile line.
+type token struct {
+	text   string
+	quoted bool
+}
+
+// isBrace reports whether the token is an unquoted opening or closing brace.
+func (t token) isBrace(brace string) bool {
+	return !t.quoted && t.text == brace
+}
+
+// Parse parses a Corefile. Every line holds a single directive, comment or
+// brace, which is how CoreDNS Corefiles are written in practice: a "{" ends
+// the line of the directive it opens, or stands alone on the next line, and a
+// "}" stands alone on its line. A block may also be opened and closed on the
+// line of its directive, holding at most one directive, such as
+// ".:53 { whoami }" or "log { class error }".
+func Parse(src string) (*Corefile, error) {
+	root := &Node{Block: []*Node{}}
+	stack := []*Node{root}
+
+	lines := strings.Split(strings.TrimSuffix(src, "\n"), "\n")
+	if src == "" {
+		lines = nil
+	}
+	for i, line := range lines {
+		lineNo := i + 1
+		line = strings.TrimSuffix(line, "\r")
+		tokens, comment, err := tokenize(line)
+		if err != nil {
+			return nil, &ParseError{Line: lineNo, Msg: err.Error()}
+		}
+
+		parent := stack[len(stack)-1]
+		indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		text := line[len(indent):]
+
+		switch {
+		case len(tokens) == 0:
+			// Blank and comment lines.
+			node := &Node{Comment: comment, parsed: true, placed: true, indent: indent, text: text}
+			node.orig = node.tokens()
+			parent.Block = append(parent.Block, node)
+
+		case tokens[0].isBrace("}"):
+			if len(tokens) > 1 {
+				return nil, &ParseError{Line: lineNo, Msg: "unexpected tokens after }"}
+			}
+			if len(stack) == 1 {
+				return nil, &ParseError{Line: lineNo, Msg: "unexpected }"}
+			}
+			parent.close = line
+			stack = stack[:len(stack)-1]
+
+		case tokens[0].isBrace("{"):
+			// A "{" alone on its line opens the block of the directive above.
+			var previous *Node
+			if n := len(parent.Block); n > 0 {
+				previous = parent.Block[n-1]
+			}
+			if len(tokens) > 1 || previous == nil || previous.Name == "" || previous.HasBlock() {
+				return nil, &ParseError{Line: lineNo, Msg: "unexpected {"}
+			}
+			previous.open = line
+			previous.Block = []*Node{}
+			stack = append(stack, previous)
+
+		default:
+			opens := tokens[len(tokens)-1].isBrace("{")
+			if opens {
+				tokens = tokens[:len(tokens)-1]
+			}
+			node, err := parseDirective(tokens)
+			if err != nil {
+				return nil, &ParseError{Line: lineNo, Msg: err.Error()}
+			}
+			if opens && node.HasBlock() {
+				return nil, &ParseError{Line: lineNo, Msg: "unexpected {"}
+			}
+
+			node.Comment = comment
+			node.parsed, node.placed, node.indent, node.text = true, true, indent, text
+			node.orig = node.tokens()
+			parent.Block = append(parent.Block, node)
+			if opens {
+				node.Block = []*Node{}
+				stack = append(stack, node)
+			}
+		}
+	}
+
+	if len(stack) > 1 {
+		return nil, &ParseError{Line: len(lines), Msg: "unclosed { for " + stack[len(stack)-1].Name}
+	}
+	return &Corefile{Nodes: root.Block}, nil
+}
+
+// parseDirective parses the tokens of a directive line, without a trailing
+// "{" opening a block on the next lines. A block opened and closed on the line
+// holds the directive made of the tokens between its braces, if any.
+func parseDirective(tokens []token) (*Node, error) {
+	brace := slices.IndexFunc(tokens, func(t token) bool { return t.isBrace("{") || t.isBrace("}") })
+	if brace == -1 {
+		node := &Node{Name: tokens[0].text}
+		for _, t := range tokens[1:] {
+			node.Args = append(node.Args, t.text)
+		}
+		return node, nil
+	}
+	if brace == 0 || !tokens[brace].isBrace("{") || !tokens[len(tokens)-1].isBrace("}") {
+		return nil, errors.New("braces must be on their own line, end it, or enclose the rest of it")
+	}
+
+	node, err := parseDirective(tokens[:brace])
+	if err != nil {
+		return nil, err
+	}
+	node.Block = []*Node{}
+	if inner := tokens[brace+1 : len(tokens)-1]; len(inner) > 0 {
+		child, err := parseDirective(inner)
+		if err != nil {
+			return nil, err
+		}
+		child.parsed = true
+		child.text = child.inlineText()
+		child.orig = child.tokens()
+		node.Block = append(node.Block, child)
+	}
+	node.inline = slices.Clone(node.Block)
+	return node, nil
+}
+
+// tokenize splits a line into tokens and a trailing comment. Tokens are
+// separated by whitespace; double quotes group words and support backslash
+// escapes; a '#' starting a token starts a comment.
+func tokenize(line string) ([]token, string, error) {
+	var tokens []token
+	for i := 0; i < len(line); {
+		switch c := line[i]; {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '#':
+			return tokens, strings.TrimRight(line[i:], " \t"), nil
+		case c == '"':
+			var b strings.Builder
+			i++
+			for {
+				if i >= len(line) {
+					return nil, "", errUnterminatedQuote
+				}
+				if line[i] == '\\' && i+1 < len(line) && (line[i+1] == '"' || line[i+1] == '\\') {
+					b.WriteByte(line[i+1])
+					i += 2
+					continue
+				}
+				if line[i] == '"' {
+					i++
+					break
+				}
+				b.WriteByte(line[i])
+				i++
+			}
+			tokens = append(tokens, token{text: b.String(), quoted: true})
+		default:
+			start := i
+			for i < len(line) && line[i] != ' ' && line[i] != '\t' {
+				i++
+			}
+			tokens = append(tokens, token{text: line[start:i]})
+		}
+	}
+	return tokens, "", nil
+}
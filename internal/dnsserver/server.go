@@ -0,0 +1,283 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package dnsserver implements a small DNS server answering authoritatively
+// for a set of hosts held in memory, which can be swapped at any time.
+package dnsserver
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	"github.com/go-logr/logr"
+	"github.com/miekg/dns"
+)
+
+// DefaultTTL is the TTL of the answers when Server.TTL is not set.
+const DefaultTTL = 30
+
+// Record is a host answered by the server.
+type Record struct {
+	// Name is the host, optionally starting with a "*." wildcard label.
+	Name string
+	// SuffixMatch lets a wildcard match any number of labels rather than one.
+	SuffixMatch bool
+	// IPs are the addresses of the host. When there are none, the host is an
+	// alias of Target.
+	IPs []net.IP
+	// Target is the name the host is an alias of, when it has no IPs.
+	Target string
+}
+
+// String formats the record as its name followed by its addresses or target.
+func (r Record) String() string {
+	if len(r.IPs) == 0 {
+		return fmt.Sprintf("%s CNAME %s", dns.Fqdn(r.Name), dns.Fqdn(r.Target))
+	}
+	ips := make([]string, len(r.IPs))
+	for i, ip := range r.IPs {
+		ips[i] = ip.String()
+	}
+	return fmt.Sprintf("%s %s", dns.Fqdn(r.Name), strings.Join(ips, " "))
+}
+
+// matches reports whether the record answers the given fully qualified,
+// lower-cased name.
+func (r Record) matches(name string) bool {
+	host := strings.ToLower(dns.Fqdn(r.Name))
+	suffix, wildcard := strings.CutPrefix(host, "*")
+	if !wildcard {
+		return name == host
+	}
+	label, ok := strings.CutSuffix(name, suffix)
+	return ok && label != "" && (r.SuffixMatch || !strings.Contains(label, "."))
+}
+
+// Resolver looks up the addresses of the targets of aliases.
+type Resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// Server answers queries for its records over UDP and TCP. Names it has no
+// record for are forwarded to Upstream, or answered with NXDOMAIN.
+type Server struct {
+	// Addr is the address to listen on, such as ":5353".
+	Addr string
+	// Upstream, if set, is the address of a DNS server answering the names
+	// without a record, such as "10.0.0.10:53".
+	Upstream string
+	// TTL of the answers, DefaultTTL if zero.
+	TTL uint32
+	// Resolver looks up the addresses of alias targets, so clients get a
+	// complete answer. net.DefaultResolver is used when nil.
+	Resolver Resolver
+	Log      logr.Logger
+
+	records atomic.Pointer[[]Record]
+}
+
+// SetRecords replaces the records answered by the server. Exact names are
+// matched first, then wildcards in the given order.
+func (s *Server) SetRecords(records []Record) {
+	records = slices.Clone(records)
+	s.records.Store(&records)
+}
+
+// Records returns the records answered by the server.
+func (s *Server) Records() []Record {
+	if records := s.records.Load(); records != nil {
+		return *records
+	}
+	return nil
+}
+
+// lookup returns the record answering the given name, if any.
+func (s *Server) lookup(name string) (Record, bool) {
+	records := s.Records()
+	for _, wildcard := range []bool{false, true} {
+		for _, record := range records {
+			if strings.HasPrefix(record.Name, "*.") == wildcard && record.matches(name) {
+				return record, true
+			}
+		}
+	}
+	return Record{}, false
+}
+
+// Start listens on Addr over UDP and TCP and serves until ctx is done.
+func (s *Server) Start(ctx context.Context) error {
+	packetConn, err := net.ListenPacket("udp", s.Addr)
+	if err != nil {
+		return err
+	}
+	listener, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		_ = packetConn.Close()
+		return err
+	}
+	return s.Serve(ctx, packetConn, listener)
+}
+
+// Serve answers queries received on the given connections until ctx is done.
+func (s *Server) Serve(ctx context.Context, packetConn net.PacketConn, listener net.Listener) error {
+	servers := []*dns.Server{
+		{PacketConn: packetConn, Handler: s},
+		{Listener: listener, Handler: s},
+	}
+	errs := make(chan error, len(servers))
+	for _, server := range servers {
+		go func() { errs <- server.ActivateAndServe() }()
+	}
+	s.Log.Info("Serving DNS", "address", listener.Addr().String())
+
+	var err error
+	select {
+	case <-ctx.Done():
+	case err = <-errs:
+	}
+	for _, server := range servers {
+		_ = server.Shutdown()
+	}
+	return err
+}
+
+// NeedLeaderElection makes the server run on the leader only, the one
+// replica whose records are kept up to date.
+func (s *Server) NeedLeaderElection() bool {
+	return true
+}
+
+// ServeDNS answers a query.
+func (s *Server) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
+	if len(req.Question) != 1 {
+		s.reply(w, new(dns.Msg).SetRcode(req, dns.RcodeFormatError))
+		return
+	}
+	question := req.Question[0]
+	name := strings.ToLower(question.Name)
+
+	record, ok := s.lookup(name)
+	if !ok {
+		s.reply(w, s.forward(w, req))
+		return
+	}
+
+	resp := new(dns.Msg).SetReply(req)
+	resp.Authoritative = true
+	ips := record.IPs
+	if len(ips) == 0 {
+		resp.Answer = append(resp.Answer, &dns.CNAME{Hdr: s.header(question.Name, dns.TypeCNAME), Target: dns.Fqdn(record.Target)})
+		if question.Qtype == dns.TypeCNAME {
+			s.reply(w, resp)
+			return
+		}
+		question.Name = dns.Fqdn(record.Target)
+		ips = s.resolve(record.Target)
+	}
+	for _, ip := range ips {
+		switch {
+		case ip.To4() != nil && question.Qtype == dns.TypeA:
+			resp.Answer = append(resp.Answer, &dns.A{Hdr: s.header(question.Name, dns.TypeA), A: ip.To4()})
+		case ip.To4() == nil && question.Qtype == dns.TypeAAAA:
+			resp.Answer = append(resp.Answer, &dns.AAAA{Hdr: s.header(question.Name, dns.TypeAAAA), AAAA: ip})
+		}
+	}
+	if len(resp.Answer) == 0 {
+		// NODATA: the name exists without records of the type
+		resp.Ns = []dns.RR{s.soa(strings.TrimPrefix(dns.Fqdn(record.Name), "*."))}
+	}
+	s.reply(w, resp)
+}
+
+// forward returns the answer of Upstream to a query for a name without a
+// record, or NXDOMAIN.
+func (s *Server) forward(w dns.ResponseWriter, req *dns.Msg) *dns.Msg {
+	if s.Upstream == "" {
+		resp := new(dns.Msg).SetRcode(req, dns.RcodeNameError)
+		resp.Authoritative = true
+		name := dns.Fqdn(req.Question[0].Name)
+		apex := "."
+		if labels := dns.Split(name); len(labels) > 1 {
+			apex = name[labels[1]:]
+		}
+		resp.Ns = []dns.RR{s.soa(apex)}
+		return resp
+	}
+
+	c := &dns.Client{Net: "udp"}
+	if _, ok := w.RemoteAddr().(*net.TCPAddr); ok {
+		c.Net = "tcp"
+	}
+	resp, _, err := c.Exchange(req, s.Upstream)
+	if err != nil {
+		s.Log.Error(err, "unable to forward query", "name", req.Question[0].Name, "upstream", s.Upstream)
+		return new(dns.Msg).SetRcode(req, dns.RcodeServerFailure)
+	}
+	return resp
+}
+
+// resolve returns the addresses of the target of an alias.
+func (s *Server) resolve(target string) []net.IP {
+	resolver := s.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	addrs, err := resolver.LookupIPAddr(context.Background(), dns.Fqdn(target))
+	if err != nil {
+		s.Log.V(1).Info("Unable to resolve alias target", "target", target, "error", err.Error())
+		return nil
+	}
+	ips := make([]net.IP, len(addrs))
+	for i, addr := range addrs {
+		ips[i] = addr.IP
+	}
+	return ips
+}
+
+// soa returns the SOA record put in the authority section of negative
+// answers, so that resolvers cache them no longer than the TTL (RFC 2308). The
+// server has no zone of its own: apex is the closest name it is answering for.
+func (s *Server) soa(apex string) dns.RR {
+	hdr := s.header(apex, dns.TypeSOA)
+	return &dns.SOA{
+		Hdr:     hdr,
+		Ns:      dns.Fqdn("ns.dns." + strings.TrimSuffix(apex, ".")),
+		Mbox:    dns.Fqdn("hostmaster." + strings.TrimSuffix(apex, ".")),
+		Serial:  1,
+		Refresh: 7200,
+		Retry:   1800,
+		Expire:  86400,
+		Minttl:  hdr.Ttl,
+	}
+}
+
+func (s *Server) header(name string, rrtype uint16) dns.RR_Header {
+	ttl := s.TTL
+	if ttl == 0 {
+		ttl = DefaultTTL
+	}
+	return dns.RR_Header{Name: name, Rrtype: rrtype, Class: dns.ClassINET, Ttl: ttl}
+}
+
+func (s *Server) reply(w dns.ResponseWriter, resp *dns.Msg) {
+	if err := w.WriteMsg(resp); err != nil {
+		s.Log.V(1).Info("Unable to write DNS response", "error", err.Error())
+	}
+}
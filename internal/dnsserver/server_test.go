@@ -0,0 +1,187 @@
+package dnsserver
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// fakeResolver resolves every name to the same addresses.
+type fakeResolver []net.IPAddr
+
+func (r fakeResolver) LookupIPAddr(context.Context, string) ([]net.IPAddr, error) {
+	return r, nil
+}
+
+// startServer serves s on a local UDP and TCP listener and returns its address.
+func startServer(t *testing.T, s *Server) string {
+	t.Helper()
+	packetConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", packetConn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- s.Serve(ctx, packetConn, listener) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Serve() returned error: %v", err)
+		}
+	})
+	return packetConn.LocalAddr().String()
+}
+
+// answers returns the answers of a query as strings.
+func answers(t *testing.T, network, addr, name string, qtype uint16) (int, []string) {
+	t.Helper()
+	c := &dns.Client{Net: network}
+	resp, _, err := c.Exchange(new(dns.Msg).SetQuestion(name, qtype), addr)
+	if err != nil {
+		t.Fatalf("unable to query %s over %s: %v", name, network, err)
+	}
+	var rrs []string
+	for _, rr := range resp.Answer {
+		rrs = append(rrs, rr.String())
+	}
+	return resp.Rcode, rrs
+}
+
+func TestServer(t *testing.T) {
+	upstream := &Server{}
+	upstream.SetRecords([]Record{{Name: "other.example.net", IPs: []net.IP{net.ParseIP("192.0.2.1")}}})
+	s := &Server{
+		Upstream: startServer(t, upstream),
+		Resolver: fakeResolver{{IP: net.ParseIP("198.51.100.7")}},
+	}
+	s.SetRecords([]Record{
+		{Name: "www.example.com", IPs: []net.IP{net.ParseIP("10.96.0.10"), net.ParseIP("fd00::10")}},
+		{Name: "external.example.com", Target: "gateway.example.org"},
+		{Name: "*.apps.example.com", IPs: []net.IP{net.ParseIP("10.96.0.11")}},
+		{Name: "*.example.com", SuffixMatch: true, IPs: []net.IP{net.ParseIP("10.96.0.12")}},
+	})
+	addr := startServer(t, s)
+
+	tests := []struct {
+		name     string
+		qtype    uint16
+		rcode    int
+		expected []string
+	}{
+		{
+			name:     "WWW.example.com.",
+			qtype:    dns.TypeA,
+			expected: []string{"WWW.example.com.\t30\tIN\tA\t10.96.0.10"},
+		},
+		{
+			name:     "www.example.com.",
+			qtype:    dns.TypeAAAA,
+			expected: []string{"www.example.com.\t30\tIN\tAAAA\tfd00::10"},
+		},
+		{
+			name:  "www.example.com.",
+			qtype: dns.TypeMX,
+		},
+		{
+			name:  "external.example.com.",
+			qtype: dns.TypeA,
+			expected: []string{
+				"external.example.com.\t30\tIN\tCNAME\tgateway.example.org.",
+				"gateway.example.org.\t30\tIN\tA\t198.51.100.7",
+			},
+		},
+		{
+			name:     "web.apps.example.com.",
+			qtype:    dns.TypeA,
+			expected: []string{"web.apps.example.com.\t30\tIN\tA\t10.96.0.11"},
+		},
+		{
+			name:     "a.b.apps.example.com.",
+			qtype:    dns.TypeA,
+			expected: []string{"a.b.apps.example.com.\t30\tIN\tA\t10.96.0.12"},
+		},
+		{
+			name:     "other.example.net.",
+			qtype:    dns.TypeA,
+			expected: []string{"other.example.net.\t30\tIN\tA\t192.0.2.1"},
+		},
+		{
+			name:     "other.example.org.",
+			qtype:    dns.TypeA,
+			rcode:    dns.RcodeNameError,
+			expected: nil,
+		},
+	}
+	for _, network := range []string{"udp", "tcp"} {
+		for _, tt := range tests {
+			t.Run(network+" "+tt.name+" "+dns.TypeToString[tt.qtype], func(t *testing.T) {
+				rcode, actual := answers(t, network, addr, tt.name, tt.qtype)
+				if rcode != tt.rcode || !reflect.DeepEqual(actual, tt.expected) {
+					t.Errorf("unexpected answer %s %v, expected %s %v",
+						dns.RcodeToString[rcode], actual, dns.RcodeToString[tt.rcode], tt.expected)
+				}
+			})
+		}
+	}
+
+	// Records are swapped without restarting the server.
+	s.SetRecords(nil)
+	if rcode, _ := answers(t, "udp", addr, "www.example.com.", dns.TypeA); rcode != dns.RcodeNameError {
+		t.Errorf("expected NXDOMAIN once the record is removed, got %s", dns.RcodeToString[rcode])
+	}
+}
+
+func TestServerNegativeAnswers(t *testing.T) {
+	s := &Server{}
+	s.SetRecords([]Record{
+		{Name: "www.example.com", IPs: []net.IP{net.ParseIP("10.96.0.10")}},
+		{Name: "*.apps.example.com", IPs: []net.IP{net.ParseIP("10.96.0.11")}},
+	})
+	addr := startServer(t, s)
+
+	tests := []struct {
+		name     string
+		qtype    uint16
+		rcode    int
+		expected string
+	}{
+		{
+			name:     "www.example.com.",
+			qtype:    dns.TypeAAAA,
+			expected: "www.example.com.\t30\tIN\tSOA\tns.dns.www.example.com. hostmaster.www.example.com. 1 7200 1800 86400 30",
+		},
+		{
+			name:     "web.apps.example.com.",
+			qtype:    dns.TypeMX,
+			expected: "apps.example.com.\t30\tIN\tSOA\tns.dns.apps.example.com. hostmaster.apps.example.com. 1 7200 1800 86400 30",
+		},
+		{
+			name:     "other.example.com.",
+			qtype:    dns.TypeA,
+			rcode:    dns.RcodeNameError,
+			expected: "example.com.\t30\tIN\tSOA\tns.dns.example.com. hostmaster.example.com. 1 7200 1800 86400 30",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name+" "+dns.TypeToString[tt.qtype], func(t *testing.T) {
+			resp, _, err := new(dns.Client).Exchange(new(dns.Msg).SetQuestion(tt.name, tt.qtype), addr)
+			if err != nil {
+				t.Fatalf("unable to query %s: %v", tt.name, err)
+			}
+			if resp.Rcode != tt.rcode || len(resp.Answer) != 0 {
+				t.Errorf("unexpected answer %s %v, expected %s without records",
+					dns.RcodeToString[resp.Rcode], resp.Answer, dns.RcodeToString[tt.rcode])
+			}
+			if len(resp.Ns) != 1 || resp.Ns[0].String() != tt.expected {
+				t.Errorf("unexpected authority section %v, expected %s", resp.Ns, tt.expected)
+			}
+		})
+	}
+}